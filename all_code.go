@@ -17,7 +17,7 @@ type CodeLine struct {
 }
 
 // collectCodeLines collects all lines of code from Go files
-func collectCodeLines(pkgDir string) ([]CodeLine, error) {
+func collectCodeLines(pkgDir string, errs *collectorErrors) ([]CodeLine, error) {
 	var results []CodeLine
 
 	err := filepath.Walk(pkgDir, func(path string, info os.FileInfo, err error) error {
@@ -30,7 +30,8 @@ func collectCodeLines(pkgDir string) ([]CodeLine, error) {
 
 			data, err := os.ReadFile(path)
 			if err != nil {
-				return err
+				errs.add("code", path, err)
+				return nil
 			}
 
 			lines := strings.Split(string(data), "\n")
@@ -52,8 +53,8 @@ func collectCodeLines(pkgDir string) ([]CodeLine, error) {
 	return results, nil
 }
 
-func populateCode(ctx context.Context, db *sql.DB, pkgDir string) error {
-	allCode, err := collectCodeLines(pkgDir)
+func populateCode(ctx context.Context, db *sql.DB, pkgDir string, errs *collectorErrors) error {
+	allCode, err := collectCodeLines(pkgDir, errs)
 	if err != nil {
 		return fmt.Errorf("failed to collect coverage results: %w", err)
 	}
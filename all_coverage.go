@@ -22,10 +22,11 @@ type CoverageResult struct {
 	FunctionName    string `json:"function_name"`
 }
 
-func collectCoverageResults(pkgDir string) ([]CoverageResult, error) {
+func collectCoverageResults(pkgDir string, errs *collectorErrors) ([]CoverageResult, error) {
 	profiles, err := cover.ParseProfiles("coverage.out")
 	if err != nil {
-		return nil, err
+		errs.add("coverage", "coverage.out", err)
+		return nil, nil
 	}
 
 	var results []CoverageResult
@@ -35,7 +36,7 @@ func collectCoverageResults(pkgDir string) ([]CoverageResult, error) {
 		for _, block := range profile.Blocks {
 			functionName, err := getFunctionName(pkgDir+"/"+fileName, block.StartLine)
 			if err != nil {
-				return nil, fmt.Errorf("failed to retrieve function name: %w", err)
+				errs.add("coverage", pkgDir+"/"+fileName, fmt.Errorf("failed to retrieve function name: %w", err))
 			}
 
 			results = append(results, CoverageResult{
@@ -55,8 +56,8 @@ func collectCoverageResults(pkgDir string) ([]CoverageResult, error) {
 	return results, nil
 }
 
-func populateCoverageResults(ctx context.Context, db *sql.DB, pkgDir string) error {
-	coverageResults, err := collectCoverageResults(pkgDir)
+func populateCoverageResults(ctx context.Context, db *sql.DB, pkgDir string, errs *collectorErrors) error {
+	coverageResults, err := collectCoverageResults(pkgDir, errs)
 	if err != nil {
 		return fmt.Errorf("failed to collect coverage results: %w", err)
 	}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
@@ -18,25 +19,46 @@ type TestEvent struct {
 	Test    string    `json:"test"`
 	Elapsed *float64  `json:"elapsed,omitempty"`
 	Output  *string   `json:"output,omitempty"`
+
+	// Seq is the position of the test in the execution order of its package, starting at 1
+	Seq int `json:"-"`
 }
 
-// collectTestResults runs `go test -json` and parses the output
-func collectTestResults(pkgDir string) ([]TestEvent, error) {
-	cmd := exec.Command("go", "test", pkgDir, "-json", "-coverprofile=coverage.out")
+// runTests runs `go test -json` with the given extra arguments and environment and parses the output
+func runTests(pkgDir string, testArgs, testEnv []string) ([]TestEvent, error) {
+	args := append([]string{"test", pkgDir, "-json", "-coverprofile=coverage.out"}, testArgs...)
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), testEnv...)
 	output, _ := cmd.Output()
-	tests, err := parseTestOutput(output)
+	events, err := parseTestOutput(output)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse test output: %w", err)
 	}
+	return events, nil
+}
+
+// collectTestResults keeps only the final pass or fail event of each test, numbered by the order
+// in which the tests started
+func collectTestResults(events []TestEvent) []TestEvent {
+	seq := make(map[string]int)
+	started := make(map[string]int)
+	for _, event := range events {
+		if event.Test == "" || event.Action != "run" {
+			continue
+		}
+		started[event.Package]++
+		seq[event.Package+"\x00"+event.Test] = started[event.Package]
+	}
 
 	var results []TestEvent
-	for _, test := range tests {
+	for _, test := range events {
 		if test.Test == "" || (test.Action != "pass" && test.Action != "fail") {
 			continue
 		}
+		test.Seq = seq[test.Package+"\x00"+test.Test]
 		results = append(results, test)
 	}
-	return results, nil
+	return results
 }
 
 func parseTestOutput(output []byte) ([]TestEvent, error) {
@@ -49,15 +71,12 @@ func parseTestOutput(output []byte) ([]TestEvent, error) {
 	return result, nil
 }
 
-func populateTestResults(ctx context.Context, db *sql.DB, pkgDir string) ([]TestEvent, error) {
-	testResults, err := collectTestResults(pkgDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to collect test results: %w", err)
-	}
+func populateTestResults(ctx context.Context, db *sql.DB, events []TestEvent) ([]TestEvent, error) {
+	testResults := collectTestResults(events)
 
 	for _, test := range testResults {
-		insertSQL := "INSERT INTO all_tests (\"time\", \"action\", package, test, elapsed, \"output\") VALUES (?, ?, ?, ?, ?, ?);"
-		_, err = db.ExecContext(ctx, insertSQL, test.Time, test.Action, test.Package, test.Test, test.Elapsed, test.Output)
+		insertSQL := "INSERT INTO all_tests (\"time\", \"action\", package, test, elapsed, \"output\", seq) VALUES (?, ?, ?, ?, ?, ?, ?);"
+		_, err := db.ExecContext(ctx, insertSQL, test.Time, test.Action, test.Package, test.Test, test.Elapsed, test.Output, test.Seq)
 		if err != nil {
 			return nil, fmt.Errorf("failed to insert test results: %w", err)
 		}
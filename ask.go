@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// askChoice is an answer to a question of tq ask, with the table it reads and the condition it adds to the query
+type askChoice struct {
+	label string
+	table string
+	sql   string
+}
+
+func askCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("ask", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	flags.BoolVar(&opts.noTTY, "no-tty", false, "read answers line by line without terminal features (automatic when stdin is not a terminal)")
+	flags.Parse(args)
+	opts.maxCellBytes = 1024
+	opts.noLint = true
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rl, err := newLineReader(opts.noTTY)
+	if err != nil {
+		return fmt.Errorf("failed to initialize prompt: %w", err)
+	}
+	defer rl.Close()
+
+	query, err := askQuery(ctx, db, rl)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n\n", query)
+	return runQuery(ctx, os.Stdout, db, query, opts)
+}
+
+// askQuery walks through the topic, scope and threshold questions and builds the matching query
+func askQuery(ctx context.Context, db *sql.DB, rl lineReader) (string, error) {
+	topic, err := ask(rl, "What do you want to know about?", []askChoice{
+		{label: "coverage"},
+		{label: "failures"},
+		{label: "durations"},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	scopes, err := askScopes(ctx, db)
+	if err != nil {
+		return "", err
+	}
+	scope, err := ask(rl, "Which packages?", scopes)
+	if err != nil {
+		return "", err
+	}
+
+	switch topic.label {
+	case "coverage":
+		threshold, err := ask(rl, "Which functions?", []askChoice{
+			{label: "not covered at all", sql: "coverage = 0"},
+			{label: "below 50% coverage", sql: "coverage < 50"},
+			{label: "below 80% coverage", sql: "coverage < 80"},
+			{label: "not fully covered", sql: "coverage < 100"},
+		})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`select package, file, function_name,
+       round(sum(case when count > 0 then stmt_num else 0 end) * 100.0 / sum(stmt_num), 1) as coverage
+  from all_coverage%s
+ group by package, file, function_name
+having %s
+ order by coverage, package, file, function_name;`, where(scope.sql), threshold.sql), nil
+	case "failures":
+		threshold, err := ask(rl, "Which failures?", []askChoice{
+			{label: "all of them", table: "test_failures"},
+			{label: "only those with parsed expected and actual values", table: "test_failures", sql: "expected is not null"},
+			{label: "only those differing in whitespace", table: "whitespace_only_failures"},
+		})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`select package, test, message, expected, actual
+  from %s%s
+ order by package, test;`, threshold.table, where(scope.sql, threshold.sql)), nil
+	default:
+		threshold, err := ask(rl, "Which tests?", []askChoice{
+			{label: "slower than 100ms", sql: "elapsed >= 0.1"},
+			{label: "slower than 1s", sql: "elapsed >= 1"},
+			{label: "slower than 10s", sql: "elapsed >= 10"},
+		})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`select package, test, action, elapsed
+  from all_tests%s
+ order by elapsed desc, package, test;`, where(scope.sql, threshold.sql)), nil
+	}
+}
+
+// askScopes offers every package of the database, plus all of them
+func askScopes(ctx context.Context, db *sql.DB) ([]askChoice, error) {
+	rows, err := db.QueryContext(ctx, "SELECT package FROM all_tests UNION SELECT package FROM all_coverage ORDER BY 1;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w", err)
+	}
+	defer rows.Close()
+
+	choices := []askChoice{{label: "all packages"}}
+	for rows.Next() {
+		var pkg string
+		if err := rows.Scan(&pkg); err != nil {
+			return nil, fmt.Errorf("failed to read package: %w", err)
+		}
+		choices = append(choices, askChoice{label: pkg, sql: "package = '" + strings.ReplaceAll(pkg, "'", "''") + "'"})
+	}
+	return choices, rows.Err()
+}
+
+// ask prints a question with numbered choices and reads answers until a valid one is given
+func ask(rl lineReader, question string, choices []askChoice) (askChoice, error) {
+	fmt.Println(question)
+	for i, choice := range choices {
+		fmt.Printf("  %d) %s\n", i+1, choice.label)
+	}
+
+	rl.SetPrompt("? ")
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, io.EOF) {
+			return askChoice{}, fmt.Errorf("no answer to %q", question)
+		}
+		if err != nil {
+			return askChoice{}, fmt.Errorf("failed to read answer: %w", err)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && n >= 1 && n <= len(choices) {
+			return choices[n-1], nil
+		}
+		fmt.Printf("please answer with a number between 1 and %d\n", len(choices))
+	}
+}
+
+// where joins the non empty conditions into a where clause
+func where(conditions ...string) string {
+	var nonEmpty []string
+	for _, condition := range conditions {
+		if condition != "" {
+			nonEmpty = append(nonEmpty, condition)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return ""
+	}
+	return "\n where " + strings.Join(nonEmpty, "\n   and ")
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// Baseline records the failures and coverage gaps that existed when a quality gate was adopted,
+// so `tq check --baseline` only fails on new ones
+type Baseline struct {
+	CreatedAt    time.Time      `json:"created_at"`
+	Failures     []BaselineTest `json:"failures"`
+	CoverageGaps []CoverageGap  `json:"coverage_gaps"`
+}
+
+// BaselineTest identifies a failed test
+type BaselineTest struct {
+	Package string `json:"package"`
+	Test    string `json:"test"`
+}
+
+// CoverageGap represents a function with uncovered statements. Gaps are tracked per function
+// rather than per block so unrelated edits moving code around don't make them look new.
+type CoverageGap struct {
+	Package   string `json:"package"`
+	File      string `json:"file"`
+	Function  string `json:"function"`
+	Uncovered int    `json:"uncovered_statements"`
+}
+
+func baselineCmd(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "create" {
+		return baselineCreateCmd(ctx, args[1:])
+	}
+
+	fmt.Fprintln(os.Stderr, "Usage of baseline: tq baseline create [flags] baseline.json")
+	os.Exit(2)
+	return nil
+}
+
+func baselineCreateCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("baseline create", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of baseline create: tq baseline create [flags] baseline.json")
+		flags.PrintDefaults()
+	}
+	positional := parseInterspersed(flags, args)
+
+	if len(positional) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	baseline, err := collectBaseline(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(positional[0], append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+
+	fmt.Printf("baseline of %d failure(s) and %d coverage gap(s) written to %s\n", len(baseline.Failures), len(baseline.CoverageGaps), positional[0])
+	return nil
+}
+
+// baselineCheckCmd fails when the run has failures or coverage gaps that are not in the baseline
+func baselineCheckCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	baselineFile := flags.String("baseline", "", "baseline file listing the pre-existing failures and coverage gaps")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of check: tq check --baseline baseline.json [flags] | tq check ratchet [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *baselineFile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*baselineFile)
+	if err != nil {
+		return fmt.Errorf("failed to read baseline: %w", err)
+	}
+
+	var baseline Baseline
+	err = json.Unmarshal(data, &baseline)
+	if err != nil {
+		return fmt.Errorf("failed to parse baseline: %w", err)
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	current, err := collectBaseline(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	rows := compareBaseline(baseline, current)
+	if len(rows) == 0 {
+		fmt.Println("ok: no failures or coverage gaps beyond the baseline")
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"kind", "package", "name", "detail"})
+	t.AppendRows(rows)
+	t.Render()
+
+	return fmt.Errorf("%d new issue(s) not in the baseline %s", len(rows), *baselineFile)
+}
+
+// collectBaseline lists the failed tests and the functions with uncovered statements of a run
+func collectBaseline(ctx context.Context, db *sql.DB) (Baseline, error) {
+	baseline := Baseline{CreatedAt: time.Now().UTC()}
+
+	rows, err := db.QueryContext(ctx, "SELECT package, test FROM failed_tests ORDER BY package, test;")
+	if err != nil {
+		return Baseline{}, fmt.Errorf("failed to list failed tests: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var test BaselineTest
+		if err := rows.Scan(&test.Package, &test.Test); err != nil {
+			return Baseline{}, fmt.Errorf("failed to read failed test: %w", err)
+		}
+		baseline.Failures = append(baseline.Failures, test)
+	}
+	if err := rows.Err(); err != nil {
+		return Baseline{}, err
+	}
+
+	query := `SELECT package, file, function_name, sum(CASE WHEN count = 0 THEN stmt_num ELSE 0 END) uncovered
+	            FROM all_coverage
+	           GROUP BY package, file, function_name
+	          HAVING uncovered > 0
+	           ORDER BY package, file, function_name;`
+	gaps, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return Baseline{}, fmt.Errorf("failed to list coverage gaps: %w", err)
+	}
+	defer gaps.Close()
+
+	for gaps.Next() {
+		var gap CoverageGap
+		if err := gaps.Scan(&gap.Package, &gap.File, &gap.Function, &gap.Uncovered); err != nil {
+			return Baseline{}, fmt.Errorf("failed to read coverage gap: %w", err)
+		}
+		baseline.CoverageGaps = append(baseline.CoverageGaps, gap)
+	}
+
+	return baseline, gaps.Err()
+}
+
+// compareBaseline returns a row for every failure of current missing from the baseline and every
+// function with more uncovered statements than recorded in the baseline
+func compareBaseline(baseline, current Baseline) []table.Row {
+	knownFailures := make(map[BaselineTest]bool)
+	for _, test := range baseline.Failures {
+		knownFailures[test] = true
+	}
+
+	type function struct{ pkg, file, name string }
+	knownGaps := make(map[function]int)
+	for _, gap := range baseline.CoverageGaps {
+		knownGaps[function{gap.Package, gap.File, gap.Function}] = gap.Uncovered
+	}
+
+	var rows []table.Row
+	for _, test := range current.Failures {
+		if !knownFailures[test] {
+			rows = append(rows, table.Row{"failure", test.Package, test.Test, "new failure"})
+		}
+	}
+
+	for _, gap := range current.CoverageGaps {
+		known, ok := knownGaps[function{gap.Package, gap.File, gap.Function}]
+		switch {
+		case !ok:
+			rows = append(rows, table.Row{"coverage", gap.Package, gap.File + ":" + gap.Function, fmt.Sprintf("%d uncovered statement(s)", gap.Uncovered)})
+		case gap.Uncovered > known:
+			rows = append(rows, table.Row{"coverage", gap.Package, gap.File + ":" + gap.Function, fmt.Sprintf("%d uncovered statement(s), %d in baseline", gap.Uncovered, known)})
+		}
+	}
+
+	return rows
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// QueryBenchmark holds the timings of a statement executed several times
+type QueryBenchmark struct {
+	Statement string
+	Rows      int
+	Durations []time.Duration
+}
+
+func benchQueriesCmd(ctx context.Context, args []string) error {
+	var opts options
+	fs := flag.NewFlagSet("bench-queries", flag.ExitOnError)
+	addDatabaseFlags(fs, &opts)
+	iterations := fs.Int("iterations", 10, "number of times each statement is executed")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage of bench-queries: tq bench-queries [flags] queries.sql")
+		fs.PrintDefaults()
+	}
+	files := parseInterspersed(fs, args)
+	if len(files) != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fileName := files[0]
+	if *iterations < 1 {
+		return fmt.Errorf("invalid number of iterations: %d", *iterations)
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to read queries: %w", err)
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var results []QueryBenchmark
+	for i, stmt := range splitStatements(string(data)) {
+		result, err := benchQuery(ctx, db, stmt, *iterations)
+		if err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		results = append(results, result)
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"#", "statement", "rows", "min", "p50", "p95", "max"})
+	for i, result := range results {
+		t.AppendRow(table.Row{
+			i + 1,
+			abbreviate(stripLineComments(result.Statement), 60),
+			result.Rows,
+			result.Durations[0],
+			percentile(result.Durations, 50),
+			percentile(result.Durations, 95),
+			result.Durations[len(result.Durations)-1],
+		})
+	}
+	t.Render()
+
+	return nil
+}
+
+// benchQuery executes stmt the given number of times, reading every row, and returns the sorted durations
+func benchQuery(ctx context.Context, db *sql.DB, stmt string, iterations int) (QueryBenchmark, error) {
+	result := QueryBenchmark{Statement: stmt}
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		rows, err := db.QueryContext(ctx, stmt)
+		if err != nil {
+			return QueryBenchmark{}, fmt.Errorf("failed to run query: %w", err)
+		}
+
+		columns, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return QueryBenchmark{}, fmt.Errorf("failed to retrieve column names: %w", err)
+		}
+
+		values := make([]any, len(columns))
+		for i := range values {
+			values[i] = new(sql.RawBytes)
+		}
+
+		count := 0
+		for rows.Next() {
+			if err := rows.Scan(values...); err != nil {
+				rows.Close()
+				return QueryBenchmark{}, fmt.Errorf("failed to read row: %w", err)
+			}
+			count++
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return QueryBenchmark{}, fmt.Errorf("failed to read rows: %w", err)
+		}
+
+		result.Durations = append(result.Durations, time.Since(start))
+		result.Rows = count
+	}
+
+	sort.Slice(result.Durations, func(i, j int) bool { return result.Durations[i] < result.Durations[j] })
+	return result, nil
+}
+
+// percentile returns the nearest-rank percentile p of the sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// abbreviate collapses whitespace and truncates s to at most n runes
+func abbreviate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// stripLineComments removes the lines of stmt holding only a -- comment
+func stripLineComments(stmt string) string {
+	var lines []string
+	for _, line := range strings.Split(stmt, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitStatements splits a SQL script into statements terminated by semicolons, ignoring
+// semicolons inside quotes and comments. Comments are kept as part of the statement.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	var quote byte
+	inLineComment, inBlockComment := false, false
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		current.WriteByte(c)
+
+		switch {
+		case inLineComment:
+			inLineComment = c != '\n'
+		case inBlockComment:
+			if c == '*' && i+1 < len(script) && script[i+1] == '/' {
+				current.WriteByte('/')
+				i++
+				inBlockComment = false
+			}
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			inLineComment = true
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			inBlockComment = true
+		case c == ';':
+			if stmt := strings.TrimSpace(current.String()); !isEmptyStatement(stmt) {
+				statements = append(statements, stmt)
+			}
+			current.Reset()
+		}
+	}
+
+	if stmt := strings.TrimSpace(current.String()); !isEmptyStatement(stmt) {
+		statements = append(statements, stmt)
+	}
+	return statements
+}
+
+// isEmptyStatement reports whether stmt contains nothing but comments and semicolons
+func isEmptyStatement(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && line != ";" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
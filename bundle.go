@@ -0,0 +1,281 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// bundleFile is a file of a failure bundle, named relative to the bundle root
+type bundleFile struct {
+	name    string
+	content []byte
+}
+
+// bundleSource is a source file covered by a test. Path is relative to the root of its module,
+// or the import path of its package when the module is not known.
+type bundleSource struct {
+	pkg  string
+	file string
+	path string
+}
+
+func bundleFailureCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("bundle-failure", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	outDir := flags.String("o", "bundle", "directory where the bundle is written")
+	zipped := flags.Bool("zip", false, "write the bundle as a zip archive instead of a directory")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of bundle-failure: tq bundle-failure [flags] TestName")
+		flags.PrintDefaults()
+	}
+	testNames := parseInterspersed(flags, args)
+
+	if len(testNames) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	files, err := collectBundle(ctx, db, testNames[0])
+	if err != nil {
+		return err
+	}
+
+	if *zipped {
+		fileName := strings.TrimSuffix(*outDir, ".zip") + ".zip"
+		err = writeBundleZip(fileName, files)
+		if err != nil {
+			return err
+		}
+		fmt.Println(fileName)
+		return nil
+	}
+
+	for _, f := range files {
+		fileName := filepath.Join(*outDir, f.name)
+		err = os.MkdirAll(filepath.Dir(fileName), 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create bundle directory: %w", err)
+		}
+
+		err = os.WriteFile(fileName, f.content, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write bundle file: %w", err)
+		}
+	}
+	fmt.Println(*outDir)
+
+	return nil
+}
+
+// collectBundle gathers everything relevant to the failure of a test: its output, the sources it
+// covered, its slice of the coverage profile, the run metadata and a script rerunning it
+func collectBundle(ctx context.Context, db *sql.DB, testName string) ([]bundleFile, error) {
+	var pkg, output string
+	err := db.QueryRowContext(ctx, "SELECT package, output FROM test_failures WHERE test = ? LIMIT 1;", testName).Scan(&pkg, &output)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s did not fail in this run", testName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query test failure: %w", err)
+	}
+
+	files := []bundleFile{{name: "output.txt", content: []byte(output)}}
+
+	metadata, err := loadRunMetadata(ctx, db, "")
+	if err != nil {
+		return nil, err
+	}
+
+	profile, sources, err := collectCoverageSlice(ctx, db, testName, metadata["test_covermode"])
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, bundleFile{name: "coverage.out", content: profile})
+
+	for _, source := range sources {
+		content, err := collectSource(ctx, db, source.pkg, source.file)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, bundleFile{name: filepath.Join("sources", filepath.FromSlash(source.path)), content: content})
+	}
+
+	metadata["test"] = testName
+	metadata["test_package"] = pkg
+	for key, value := range goEnv("GOVERSION", "GOOS", "GOARCH") {
+		metadata[strings.ToLower(key)] = value
+	}
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, bundleFile{name: "metadata.json", content: append(data, '\n')})
+
+	// the package directory recorded in the metadata only exists on the machine of the run, the
+	// script uses the import path of the package instead
+	if _, ok := metadata["package"]; ok {
+		args := append(replayArgs(pkg, metadata), "-run", runPattern(testName))
+		script := fmt.Sprintf("#!/bin/sh\n# run from within the module of %s\nGOMAXPROCS=%s go %s\n", pkg, metadata["gomaxprocs"], shellJoin(args))
+		files = append(files, bundleFile{name: "rerun.sh", content: []byte(script)})
+	}
+
+	return files, nil
+}
+
+// collectCoverageSlice rebuilds the coverage profile of a single test and lists the files it covered.
+// mode is the mode of the collected profiles, databases recorded before it was kept fall back to set
+// or, when a block ran more than once, count.
+func collectCoverageSlice(ctx context.Context, db *sql.DB, testName, mode string) ([]byte, []bundleSource, error) {
+	rows, err := db.QueryContext(ctx, `SELECT c.package, c.file, c.start_line, c.start_col, c.end_line, c.end_col, c.stmt_num, c.count, ifnull(pd.module, '')
+		FROM test_coverage c LEFT JOIN package_dirs pd ON pd.package = c.package
+		WHERE c.test_name = ? ORDER BY c.package, c.file, c.start_line, c.start_col;`, testName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query test coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	maxCount := 0
+
+	// covered is keyed by the relative path, files of different packages may share a name
+	covered := make(map[string]bundleSource)
+	for rows.Next() {
+		var r CoverageResult
+		var module string
+		err := rows.Scan(&r.Package, &r.File, &r.StartLine, &r.StartColumn, &r.EndLine, &r.EndColumn, &r.StatementNumber, &r.Count, &module)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read test coverage: %w", err)
+		}
+		maxCount = max(maxCount, r.Count)
+		fmt.Fprintf(&buf, "%s/%s:%d.%d,%d.%d %d %d\n", r.Package, r.File, r.StartLine, r.StartColumn, r.EndLine, r.EndColumn, r.StatementNumber, r.Count)
+
+		if r.Count > 0 {
+			source := bundleSource{pkg: r.Package, file: r.File, path: path.Join(r.Package, r.File)}
+			if module != "" {
+				source.path = path.Join(strings.TrimPrefix(strings.TrimPrefix(r.Package, module), "/"), r.File)
+			}
+			covered[source.path] = source
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case mode != "":
+	case maxCount > 1:
+		mode = "count"
+	default:
+		mode = "set"
+	}
+	profile := append([]byte("mode: "+mode+"\n"), buf.Bytes()...)
+
+	sources := make([]bundleSource, 0, len(covered))
+	for _, source := range covered {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].path < sources[j].path })
+
+	return profile, sources, nil
+}
+
+// collectSource reassembles a source file of a package from the all_code table, which is keyed by directory
+func collectSource(ctx context.Context, db *sql.DB, pkg, file string) ([]byte, error) {
+	rows, err := db.QueryContext(ctx, `SELECT content FROM all_code
+		WHERE file = ? AND package = ifnull((SELECT dir FROM package_dirs WHERE package = ?), package)
+		ORDER BY line_number;`, file, pkg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query source code: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("failed to read source code: %w", err)
+		}
+		lines = append(lines, line)
+	}
+
+	return []byte(strings.Join(lines, "\n")), rows.Err()
+}
+
+// goEnv returns the values of go env variables, or nothing when the go command is not available
+func goEnv(names ...string) map[string]string {
+	output, err := exec.Command("go", append([]string{"env", "-json"}, names...)...).Output()
+	if err != nil {
+		return nil
+	}
+
+	var env map[string]string
+	if json.Unmarshal(output, &env) != nil {
+		return nil
+	}
+	return env
+}
+
+// runPattern returns a -run pattern matching exactly one test or subtest
+func runPattern(testName string) string {
+	parts := strings.Split(testName, "/")
+	for i, part := range parts {
+		parts[i] = "^" + regexp.QuoteMeta(part) + "$"
+	}
+	return strings.Join(parts, "/")
+}
+
+// shellJoin quotes the arguments that would be interpreted by the shell
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, " \t\n'\"\\$^*?[]()|&;<>`") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+func writeBundleZip(fileName string, files []bundleFile) error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(filepath.ToSlash(f.name))
+		if err != nil {
+			return fmt.Errorf("failed to add %s to bundle: %w", f.name, err)
+		}
+		if _, err := w.Write(f.content); err != nil {
+			return fmt.Errorf("failed to add %s to bundle: %w", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	err := os.WriteFile(fileName, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+//go:build tq_bundled
+
+package main
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Building with `-tags tq_bundled` registers a few common functions in every connection, without
+// loading any extension: the REGEXP operator and the stddev and median aggregates.
+func init() {
+	connectHooks = append(connectHooks, func(conn *sqlite3.SQLiteConn) error {
+		if err := conn.RegisterFunc("regexp", regexpMatch, true); err != nil {
+			return err
+		}
+		if err := conn.RegisterAggregator("stddev", newStddev, true); err != nil {
+			return err
+		}
+		return conn.RegisterAggregator("median", newMedian, true)
+	})
+}
+
+// regexpCache holds the compiled patterns, shared by every connection of the pool
+var regexpCache = struct {
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{patterns: make(map[string]*regexp.Regexp)}
+
+// regexpMatch implements `text REGEXP pattern`, which SQLite calls as regexp(pattern, text)
+func regexpMatch(pattern, text string) (bool, error) {
+	regexpCache.mu.Lock()
+	re, ok := regexpCache.patterns[pattern]
+	regexpCache.mu.Unlock()
+	if !ok {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		regexpCache.mu.Lock()
+		regexpCache.patterns[pattern] = re
+		regexpCache.mu.Unlock()
+	}
+	return re.MatchString(text), nil
+}
+
+// stddev computes the sample standard deviation with Welford's algorithm
+type stddev struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func newStddev() *stddev { return &stddev{} }
+
+func (s *stddev) Step(v any) {
+	x, ok := toFloat(v)
+	if !ok {
+		return
+	}
+	s.n++
+	delta := x - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (x - s.mean)
+}
+
+func (s *stddev) Done() float64 {
+	if s.n < 2 {
+		return 0
+	}
+	return math.Sqrt(s.m2 / float64(s.n-1))
+}
+
+type median struct {
+	values []float64
+}
+
+func newMedian() *median { return &median{} }
+
+func (m *median) Step(v any) {
+	if x, ok := toFloat(v); ok {
+		m.values = append(m.values, x)
+	}
+}
+
+func (m *median) Done() float64 {
+	if len(m.values) == 0 {
+		return 0
+	}
+	sort.Float64s(m.values)
+	mid := len(m.values) / 2
+	if len(m.values)%2 == 0 {
+		return (m.values[mid-1] + m.values[mid]) / 2
+	}
+	return m.values[mid]
+}
+
+// toFloat converts a numeric SQL value, NULL and other types are skipped like in the built-in aggregates
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
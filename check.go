@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// RatchetState records the best coverage achieved by each package
+type RatchetState struct {
+	UpdatedAt time.Time          `json:"updated_at"`
+	Packages  map[string]float64 `json:"packages"`
+}
+
+func checkCmd(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "ratchet" {
+		return ratchetCmd(ctx, args[1:])
+	}
+
+	return baselineCheckCmd(ctx, args)
+}
+
+func ratchetCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("check ratchet", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	stateFile := flags.String("state", "ratchet.json", "file recording the best coverage of each package")
+	tolerance := flags.Float64("tolerance", 0, "coverage decrease in percentage points tolerated before failing")
+	flags.Parse(args)
+
+	state, err := loadRatchetState(*stateFile)
+	if err != nil {
+		return err
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	current, err := packageCoverage(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	packages := make([]string, 0, len(current))
+	for pkg := range current {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"package", "best", "current", "status"})
+
+	var decreased int
+	var changed bool
+	for _, pkg := range packages {
+		coverage := current[pkg]
+		best, known := state.Packages[pkg]
+
+		var status string
+		switch {
+		case !known:
+			status = "new"
+			state.Packages[pkg] = coverage
+			changed = true
+		case coverage < best-*tolerance:
+			status = "DECREASED"
+			decreased++
+		case coverage > best:
+			status = "raised"
+			state.Packages[pkg] = coverage
+			changed = true
+		default:
+			status = "ok"
+		}
+
+		t.AppendRow(table.Row{pkg, formatPercent(best, known), formatPercent(coverage, true), status})
+	}
+	t.Render()
+
+	// high-water marks are raised even when other packages decreased
+	if changed {
+		err = saveRatchetState(*stateFile, state)
+		if err != nil {
+			return err
+		}
+	}
+
+	if decreased > 0 {
+		return fmt.Errorf("coverage decreased below the recorded high-water mark in %d package(s)", decreased)
+	}
+	return nil
+}
+
+// packageCoverage returns the statement coverage percentage of each package, rounded to two decimals
+func packageCoverage(ctx context.Context, db *sql.DB) (map[string]float64, error) {
+	query := `SELECT package, sum(CASE WHEN count > 0 THEN stmt_num ELSE 0 END) * 100.0 / sum(stmt_num) FROM all_coverage GROUP BY package HAVING sum(stmt_num) > 0;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute package coverage: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]float64)
+	for rows.Next() {
+		var pkg string
+		var coverage float64
+		if err := rows.Scan(&pkg, &coverage); err != nil {
+			return nil, fmt.Errorf("failed to read package coverage: %w", err)
+		}
+		result[pkg] = math.Round(coverage*100) / 100
+	}
+
+	return result, rows.Err()
+}
+
+func loadRatchetState(fileName string) (RatchetState, error) {
+	state := RatchetState{Packages: make(map[string]float64)}
+
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return RatchetState{}, fmt.Errorf("failed to read ratchet state: %w", err)
+	}
+
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return RatchetState{}, fmt.Errorf("failed to parse ratchet state: %w", err)
+	}
+	if state.Packages == nil {
+		state.Packages = make(map[string]float64)
+	}
+
+	return state, nil
+}
+
+func saveRatchetState(fileName string, state RatchetState) error {
+	state.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(fileName, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write ratchet state: %w", err)
+	}
+	return nil
+}
+
+func formatPercent(v float64, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", v)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// profileManifest lists the per-test coverage profiles of the collection in progress. It is written
+// before the tests run, so the profiles left behind by a crashed run can be found and removed.
+const profileManifest = ".tq-profiles"
+
+func cleanCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	flags.Parse(args)
+
+	removed, err := removeStaleProfiles()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range removed {
+		fmt.Println("removed", file)
+	}
+	return nil
+}
+
+// writeProfileManifest records the profiles about to be written
+func writeProfileManifest(profiles []string) error {
+	content := strings.Join(profiles, "\n")
+	err := os.WriteFile(profileManifest, []byte(content), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write profile manifest: %w", err)
+	}
+	return nil
+}
+
+// removeStaleProfiles removes the profiles listed by the manifest, then the manifest itself, and
+// returns the files actually removed. Only listed files are touched, never other .out files.
+func removeStaleProfiles() ([]string, error) {
+	data, err := os.ReadFile(profileManifest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile manifest: %w", err)
+	}
+
+	var removed []string
+	for _, file := range strings.Split(string(data), "\n") {
+		if file == "" {
+			continue
+		}
+
+		err := os.Remove(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove stale profile: %w", err)
+		}
+		removed = append(removed, file)
+	}
+
+	err = os.Remove(profileManifest)
+	if err != nil {
+		return removed, fmt.Errorf("failed to remove profile manifest: %w", err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// CollectorError represents a failure of a collector on a single file
+type CollectorError struct {
+	Phase string `json:"phase"`
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// collectorErrors accumulates the failures of the collectors so collection can keep going.
+// The same failure reported several times, e.g. once per coverage block of a file, is recorded once.
+type collectorErrors struct {
+	mu     sync.Mutex
+	errors []CollectorError
+	seen   map[CollectorError]bool
+}
+
+func (c *collectorErrors) add(phase, file string, err error) {
+	e := CollectorError{Phase: phase, File: file, Error: err.Error()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[CollectorError]bool)
+	}
+	if c.seen[e] {
+		return
+	}
+	c.seen[e] = true
+	c.errors = append(c.errors, e)
+
+	log.Printf("%s: skipping %s: %s", phase, file, err)
+}
+
+func populateCollectorErrors(ctx context.Context, db *sql.DB, errs *collectorErrors) error {
+	for _, e := range errs.errors {
+		insertSQL := `INSERT INTO collector_errors (phase, file, error) VALUES (?, ?, ?);`
+		_, err := db.ExecContext(ctx, insertSQL, e.Phase, e.File, e.Error)
+		if err != nil {
+			return fmt.Errorf("failed to insert collector errors: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkCollectorErrors fails when the collectors could not process every file, for --strict
+func checkCollectorErrors(ctx context.Context, db *sql.DB) error {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM collector_errors;").Scan(&n)
+	if err != nil {
+		return fmt.Errorf("failed to count collector errors: %w", err)
+	}
+	if n > 0 {
+		return fmt.Errorf("strict mode: %d file(s) could not be collected, see the collector_errors table", n)
+	}
+	return nil
+}
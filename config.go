@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigFile = ".testquery.yaml"
+
+// Config represents the contents of the .testquery.yaml file
+type Config struct {
+	// DDL lists SQL files executed right after the embedded schema, before collection
+	DDL []string `yaml:"ddl"`
+
+	// PostBuild lists SQL files or inline statements executed after collection
+	PostBuild []string `yaml:"post_build"`
+
+	// ExcludePackages lists import paths left out of collection, a trailing /... also excludes subpackages
+	ExcludePackages []string `yaml:"exclude_packages"`
+
+	// dir is the directory of the config file, relative paths are resolved against it
+	dir string
+}
+
+// loadConfig reads the config file, returning an empty config if the file doesn't exist
+func loadConfig(fileName string) (Config, error) {
+	if fileName == "" {
+		fileName = defaultConfigFile
+	}
+
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg Config
+	err = yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %w", fileName, err)
+	}
+	cfg.dir = filepath.Dir(fileName)
+
+	return cfg, nil
+}
+
+// applyDDL executes the extra DDL files declared in the config
+func (c Config) applyDDL(ctx context.Context, db *sql.DB) error {
+	for _, fileName := range c.DDL {
+		stmt, err := os.ReadFile(c.path(fileName))
+		if err != nil {
+			return fmt.Errorf("failed to read ddl file: %w", err)
+		}
+
+		_, err = db.ExecContext(ctx, string(stmt))
+		if err != nil {
+			return fmt.Errorf("failed to apply %s: %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+// applyPostBuild executes the post-build SQL declared in the config. Entries naming a .sql
+// file are read from disk, everything else is executed as an inline statement.
+func (c Config) applyPostBuild(ctx context.Context, db *sql.DB) error {
+	for _, entry := range c.PostBuild {
+		stmt, name := entry, "post_build statement"
+		if isSQLFile(entry) {
+			data, err := os.ReadFile(c.path(entry))
+			if err != nil {
+				return fmt.Errorf("failed to read post_build file: %w", err)
+			}
+			stmt, name = string(data), entry
+		}
+
+		_, err := db.ExecContext(ctx, stmt)
+		if err != nil {
+			return fmt.Errorf("failed to apply %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c Config) path(fileName string) string {
+	if filepath.IsAbs(fileName) {
+		return fileName
+	}
+	return filepath.Join(c.dir, fileName)
+}
+
+func isSQLFile(entry string) bool {
+	return strings.HasSuffix(entry, ".sql") && !strings.ContainsAny(entry, " \t\n")
+}
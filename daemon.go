@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// RunSummary represents the summary of a collection run pushed to webhooks
+type RunSummary struct {
+	Time        time.Time `json:"time"`
+	Package     string    `json:"package"`
+	Database    string    `json:"database"`
+	Passed      int       `json:"passed"`
+	Failed      int       `json:"failed"`
+	FailedTests []string  `json:"failed_tests"`
+	Coverage    float64   `json:"coverage"`
+}
+
+func daemonCmd(ctx context.Context, args []string) error {
+	var opts options
+	var webhooks stringList
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	fs.StringVar(&opts.pkgDir, "pkg", ".", "directory of the package to test")
+	fs.StringVar(&opts.dbFile, "dbfile", "testquery.db", "database file rebuilt on every run")
+	fs.StringVar(&opts.configFile, "config", defaultConfigFile, "config file declaring extra ddl and post-build sql")
+	fs.StringVar(&opts.setupCmd, "setup-cmd", "", "shell command run once before each collection")
+	fs.StringVar(&opts.teardownCmd, "teardown-cmd", "", "shell command run once after each collection")
+	fs.StringVar(&opts.perTestStrategy, "per-test-strategy", perTestProcess, "how per-test coverage is collected (process or binary)")
+	fs.StringVar(&opts.jobs, "jobs", "auto", "number of tests run concurrently to collect per-test coverage, or auto to size it from the CPU count and back off when the machine is loaded")
+	fs.BoolVar(&opts.strict, "strict", false, "skip the runs where any file could not be collected, keeping the previous database")
+	fs.BoolVar(&opts.noVacuum, "no-vacuum", false, "save the database with a fast page copy instead of VACUUM INTO")
+	every := fs.Duration("every", time.Hour, "interval between collection runs")
+	fs.Var(&webhooks, "webhook", "URL receiving a JSON summary after each run (can be repeated)")
+	fs.Parse(args)
+
+	if *every <= 0 {
+		return fmt.Errorf("invalid interval: %s", *every)
+	}
+	if _, _, err := parseJobs(opts.jobs, nil); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+
+	for {
+		summary, err := collectOnce(ctx, opts)
+		if err != nil {
+			log.Println("collection failed:", err)
+		} else {
+			log.Printf("collected %s: %d passed, %d failed, %.1f%% coverage", summary.Package, summary.Passed, summary.Failed, summary.Coverage)
+			for _, url := range webhooks {
+				if err := pushSummary(ctx, url, summary); err != nil {
+					log.Printf("failed to push summary to %s: %s", url, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectOnce rebuilds the database file from scratch and returns a summary of the run
+func collectOnce(ctx context.Context, opts options) (RunSummary, error) {
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return RunSummary{}, err
+	}
+	defer db.Close()
+
+	summary, err := summarize(ctx, db)
+	if err != nil {
+		return RunSummary{}, err
+	}
+	summary.Package = opts.pkgDir
+	summary.Database = opts.dbFile
+
+	err = persistDatabase(ctx, db, opts.dbFile, opts.noVacuum)
+	if err != nil {
+		return RunSummary{}, err
+	}
+
+	return summary, nil
+}
+
+// summarize computes the test and coverage totals of a database
+func summarize(ctx context.Context, db *sql.DB) (RunSummary, error) {
+	summary := RunSummary{Time: time.Now()}
+
+	err := db.QueryRowContext(ctx, "SELECT (SELECT count(*) FROM passed_tests), (SELECT count(*) FROM failed_tests);").Scan(&summary.Passed, &summary.Failed)
+	if err != nil {
+		return RunSummary{}, fmt.Errorf("failed to count tests: %w", err)
+	}
+
+	err = db.QueryRowContext(ctx, "SELECT ifnull(sum(CASE WHEN count > 0 THEN stmt_num ELSE 0 END) * 100.0 / sum(stmt_num), 0) FROM all_coverage;").Scan(&summary.Coverage)
+	if err != nil {
+		return RunSummary{}, fmt.Errorf("failed to compute coverage: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT test FROM failed_tests ORDER BY test;")
+	if err != nil {
+		return RunSummary{}, fmt.Errorf("failed to list failed tests: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var test string
+		if err := rows.Scan(&test); err != nil {
+			return RunSummary{}, fmt.Errorf("failed to read test name: %w", err)
+		}
+		summary.FailedTests = append(summary.FailedTests, test)
+	}
+
+	return summary, rows.Err()
+}
+
+// pushSummary posts the summary as JSON to the webhook url
+func pushSummary(ctx context.Context, url string, summary RunSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
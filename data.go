@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log"
 
 	_ "embed"
 )
@@ -16,34 +17,134 @@ func createTables(ctx context.Context, db *sql.DB) error {
 	return err
 }
 
-func populateTables(ctx context.Context, db *sql.DB, pkgDir string) error {
-	testResults, err := populateTestResults(ctx, db, pkgDir)
+func populateTables(ctx context.Context, db *sql.DB, opts options, cfg Config) error {
+	pkgDir := opts.pkgDir
+	settings := newRunSettings(opts)
+	exclusions := newPackageExclusions(cfg.ExcludePackages)
+	var errs collectorErrors
+
+	removed, err := removeStaleProfiles()
+	if err != nil {
+		return err
+	}
+	if len(removed) > 0 {
+		log.Printf("removed %d coverage profile(s) left by a previous run", len(removed))
+	}
+
+	hasTestMain, err := detectTestMain(pkgDir)
+	if err != nil {
+		errs.add("test_main", pkgDir, err)
+	}
+	settings.HasTestMain = hasTestMain
+	if hasTestMain && settings.SetupCmd == "" {
+		log.Println("package declares TestMain: its global setup runs again for every per-test coverage run, consider moving it to --setup-cmd")
+	}
+
+	if settings.SetupCmd != "" {
+		settings.SetupDuration, err = runHook(ctx, settings.SetupCmd)
+		if err != nil {
+			return fmt.Errorf("setup command failed: %w", err)
+		}
+	}
+
+	if settings.TeardownCmd != "" {
+		defer func() {
+			if _, err := runHook(ctx, settings.TeardownCmd); err != nil {
+				log.Println("teardown command failed:", err)
+			}
+		}()
+	}
+
+	// the tests of an excluded package are not run at all, its coverage and sources not collected
+	skipped := exclusions.excludedDir(pkgDir)
+	if skipped {
+		log.Printf("package in %s is excluded by the config, skipping its tests", pkgDir)
+	}
+
+	var events []TestEvent
+	if !skipped {
+		events, err = runTests(pkgDir, settings.testArgs(), settings.testEnv())
+		if err != nil {
+			return fmt.Errorf("failed to collect test results: %w", err)
+		}
+		events = exclusions.filterEvents(events)
+	}
+
+	testResults, err := populateTestResults(ctx, db, events)
 	if err != nil {
 		return fmt.Errorf("failed to populate test results: %w", err)
 	}
 
-	err = populateCoverageResults(ctx, db, pkgDir)
+	err = populateTestFailures(ctx, db, events)
 	if err != nil {
-		return fmt.Errorf("failed to populate coverage results: %w", err)
+		return fmt.Errorf("failed to populate test failures: %w", err)
+	}
+
+	if !skipped {
+		err = populateCoverageResults(ctx, db, pkgDir, &errs)
+		if err != nil {
+			return fmt.Errorf("failed to populate coverage results: %w", err)
+		}
 	}
 
-	err = populateTestCoverageResults(ctx, db, pkgDir, testResults)
+	maxJobs, adaptive, err := parseJobs(opts.jobs, testResults)
+	if err != nil {
+		return err
+	}
+
+	jobs := &jobLimiter{max: maxJobs, adaptive: adaptive}
+	settings.TestCoverMode, err = populateTestCoverageResults(ctx, db, pkgDir, testResults, opts.perTestStrategy, jobs, &errs)
 	if err != nil {
 		return fmt.Errorf("failed to populate coverage results: %w", err)
 	}
 
-	err = populateCode(ctx, db, pkgDir)
+	// the run metadata records the mode of the per-test profiles, so it comes after them
+	err = populateRunMetadata(ctx, db, pkgDir, settings, events)
+	if err != nil {
+		return fmt.Errorf("failed to populate run metadata: %w", err)
+	}
+
+	err = populateCode(ctx, db, pkgDir, &errs)
 	if err != nil {
 		return fmt.Errorf("failed to populate code: %w", err)
 	}
 
-	return nil
-}
+	err = populatePackageDirs(ctx, db, pkgDir, &errs)
+	if err != nil {
+		return fmt.Errorf("failed to populate package dirs: %w", err)
+	}
+
+	// prune runs once package_dirs is known, to remove the code of excluded subpackages too
+	err = exclusions.prune(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	err = populateExcludedPackages(ctx, db, exclusions)
+	if err != nil {
+		return fmt.Errorf("failed to populate excluded packages: %w", err)
+	}
+
+	if !skipped {
+		err = populateGenericFunctions(ctx, db, pkgDir, &errs)
+		if err != nil {
+			return fmt.Errorf("failed to populate generic functions: %w", err)
+		}
+
+		err = populateTestFunctions(ctx, db, pkgDir, &errs)
+		if err != nil {
+			return fmt.Errorf("failed to populate test functions: %w", err)
+		}
+
+		err = populateEmbeds(ctx, db, pkgDir, &errs)
+		if err != nil {
+			return fmt.Errorf("failed to populate embeds: %w", err)
+		}
+	}
 
-func persistDatabase(db *sql.DB, dbFile string) error {
-	_, err := db.Exec("VACUUM INTO ?", dbFile)
+	err = populateCollectorErrors(ctx, db, &errs)
 	if err != nil {
-		return fmt.Errorf("failed to save database file: %w", err)
+		return fmt.Errorf("failed to populate collector errors: %w", err)
 	}
 
 	return nil
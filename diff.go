@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// matrixQueries maps each --on value of the diff command to the query producing its rows.
+// Queries return the key columns followed by a status and a duration in seconds.
+var matrixQueries = map[string]struct {
+	keys  []string
+	query string
+}{
+	"test": {
+		keys:  []string{"package", "test"},
+		query: `SELECT package, test, action, elapsed FROM all_tests;`,
+	},
+	"package": {
+		keys: []string{"package"},
+		query: `SELECT package,
+		               CASE WHEN sum(action = 'fail') > 0 THEN 'fail (' || sum(action = 'fail') || '/' || count(*) || ')' ELSE 'pass' END,
+		               sum(elapsed)
+		          FROM all_tests
+		         GROUP BY package;`,
+	},
+}
+
+// matrixCell holds the outcome of a row in one of the compared databases
+type matrixCell struct {
+	status  string
+	elapsed *float64
+}
+
+func diffCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	on := fs.String("on", "test", "granularity of the comparison (test or package)")
+	changed := fs.Bool("changed", false, "only show rows whose status differs between databases")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage of diff: tq diff [flags] run1.db run2.db [run3.db...]")
+		fs.PrintDefaults()
+	}
+	dbFiles := parseInterspersed(fs, args)
+
+	spec, ok := matrixQueries[*on]
+	if !ok {
+		return fmt.Errorf("invalid value for --on: %q", *on)
+	}
+	if len(dbFiles) < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// matrix maps the row key to one cell per database
+	matrix := make(map[string][]*matrixCell)
+	for i, dbFile := range dbFiles {
+		rows, err := collectMatrixColumn(ctx, dbFile, len(spec.keys), spec.query)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", dbFile, err)
+		}
+
+		for key, cell := range rows {
+			if matrix[key] == nil {
+				matrix[key] = make([]*matrixCell, len(dbFiles))
+			}
+			matrix[key][i] = cell
+		}
+	}
+
+	keys := make([]string, 0, len(matrix))
+	for key, cells := range matrix {
+		if *changed && !statusChanged(cells) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+
+	header := table.Row{}
+	for _, k := range spec.keys {
+		header = append(header, k)
+	}
+	for _, name := range uniqueSuffixes(dbFiles) {
+		header = append(header, name)
+	}
+	t.AppendHeader(header)
+
+	for _, key := range keys {
+		row := table.Row{}
+		for _, k := range strings.Split(key, "\x00") {
+			row = append(row, k)
+		}
+		for _, cell := range matrix[key] {
+			row = append(row, formatMatrixCell(cell))
+		}
+		t.AppendRow(row)
+	}
+	t.Render()
+
+	return nil
+}
+
+// uniqueSuffixes shortens every path to its shortest suffix of whole path elements that no other
+// path ends with, e.g. run1/testquery.db and run2/testquery.db, or just the file names when they differ
+func uniqueSuffixes(paths []string) []string {
+	elements := make([][]string, len(paths))
+	for i, path := range paths {
+		elements[i] = strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	}
+
+	suffix := func(parts []string, n int) string {
+		return strings.Join(parts[max(len(parts)-n, 0):], "/")
+	}
+
+	names := make([]string, len(paths))
+	for i, parts := range elements {
+		names[i] = paths[i]
+		for n := 1; n <= len(parts); n++ {
+			candidate := suffix(parts, n)
+			unique := true
+			for j, other := range elements {
+				if j != i && suffix(other, n) == candidate {
+					unique = false
+					break
+				}
+			}
+			if unique {
+				names[i] = candidate
+				break
+			}
+		}
+	}
+	return names
+}
+
+// collectMatrixColumn runs the matrix query against a database file, keying the rows by their key columns
+func collectMatrixColumn(ctx context.Context, dbFile string, numKeys int, query string) (map[string]*matrixCell, error) {
+	if _, err := os.Stat(dbFile); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(sqliteDriver, dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run query: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]*matrixCell)
+	for rows.Next() {
+		keys := make([]string, numKeys)
+		cell := &matrixCell{}
+
+		dest := make([]any, 0, numKeys+2)
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+		dest = append(dest, &cell.status, &cell.elapsed)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		result[strings.Join(keys, "\x00")] = cell
+	}
+
+	return result, rows.Err()
+}
+
+// statusChanged reports whether the status of a row is not the same in every database
+func statusChanged(cells []*matrixCell) bool {
+	status := func(c *matrixCell) string {
+		if c == nil {
+			return ""
+		}
+		return c.status
+	}
+
+	for _, cell := range cells[1:] {
+		if status(cell) != status(cells[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatMatrixCell(cell *matrixCell) string {
+	if cell == nil {
+		return "-"
+	}
+	if cell.elapsed == nil {
+		return cell.status
+	}
+	return fmt.Sprintf("%s %.2fs", cell.status, *cell.elapsed)
+}
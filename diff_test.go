@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueSuffixes(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{name: "different names", paths: []string{"a/before.db", "b/after.db"}, want: []string{"before.db", "after.db"}},
+		{name: "same names", paths: []string{"run1/testquery.db", "run2/testquery.db"}, want: []string{"run1/testquery.db", "run2/testquery.db"}},
+		{name: "deep paths", paths: []string{"/ci/123/run/testquery.db", "/ci/124/run/testquery.db", "local.db"}, want: []string{"123/run/testquery.db", "124/run/testquery.db", "local.db"}},
+		{name: "nested suffix", paths: []string{"x/testquery.db", "y/x/testquery.db"}, want: []string{"x/testquery.db", "y/x/testquery.db"}},
+		{name: "identical", paths: []string{"testquery.db", "testquery.db"}, want: []string{"testquery.db", "testquery.db"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uniqueSuffixes(tt.paths)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uniqueSuffixes(%q) = %q, want %q", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
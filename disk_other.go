@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// freeSpace is not implemented on this platform, the preflight check is skipped
+func freeSpace(dir string) (uint64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// variableRegexp matches $name and ${name} references in statements
+var variableRegexp = regexp.MustCompile(`\$\{(\w+)\}|\$(\w+)`)
+
+// variableNameRegexp matches the names accepted by .set
+var variableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// shellState holds the state of an interactive session shared by the dot commands
+type shellState struct {
+	vars map[string]string
+
+	// lastQuery is the last statement that ran successfully, after variable expansion
+	lastQuery string
+
+	// dbFile is the database compared by .diff when no file is given
+	dbFile string
+
+	// transcript is the markdown file queries are recorded to, nil when not recording
+	transcript *os.File
+}
+
+func newShellState(dbFile string) *shellState {
+	return &shellState{vars: make(map[string]string), dbFile: dbFile}
+}
+
+// dotCommand executes a shell command like `.set pkg internal/query`
+func (s *shellState) dotCommand(ctx context.Context, db *sql.DB, line string) error {
+	name, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+
+	switch name {
+	case ".set":
+		if args == "" {
+			s.printVars()
+			return nil
+		}
+		key, value, _ := strings.Cut(args, " ")
+		if !variableNameRegexp.MatchString(key) {
+			return fmt.Errorf("invalid variable name: %q", key)
+		}
+		s.vars[key] = strings.TrimSpace(value)
+	case ".unset":
+		delete(s.vars, args)
+	case ".diff":
+		if s.lastQuery == "" {
+			return fmt.Errorf("no previous query to diff")
+		}
+		dbFile := args
+		if dbFile == "" {
+			dbFile = s.dbFile
+		}
+		return diffQuery(ctx, os.Stdout, db, dbFile, s.lastQuery)
+	case ".record":
+		switch args {
+		case "":
+			return fmt.Errorf("usage: .record file.md | .record off")
+		case "off":
+			return s.stopRecording()
+		default:
+			return s.startRecording(args)
+		}
+	default:
+		return fmt.Errorf("unknown command: %s", name)
+	}
+	return nil
+}
+
+func (s *shellState) printVars() {
+	names := make([]string, 0, len(s.vars))
+	for name := range s.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("%s = %s\n", name, s.vars[name])
+	}
+}
+
+// expand replaces the references to shell variables in stmt with their values. Unknown
+// variables are left untouched so they can still be used as SQLite parameters.
+func (s *shellState) expand(stmt string) string {
+	return variableRegexp.ReplaceAllStringFunc(stmt, func(ref string) string {
+		m := variableRegexp.FindStringSubmatch(ref)
+		name := m[1] + m[2]
+		if value, ok := s.vars[name]; ok {
+			return value
+		}
+		return ref
+	})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Embed represents a file embedded by a //go:embed directive
+type Embed struct {
+	File         string  `json:"file"`
+	Line         int     `json:"line"`
+	Variable     string  `json:"variable"`
+	Pattern      string  `json:"pattern"`
+	ResolvedFile *string `json:"resolved_file"`
+}
+
+// collectEmbeds parses the //go:embed directives of the package and resolves their patterns to files.
+// Patterns matching nothing are kept with a nil resolved file.
+func collectEmbeds(pkgDir string, errs *collectorErrors) ([]Embed, error) {
+	fileNames, err := filepath.Glob(filepath.Join(pkgDir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Embed
+	fset := token.NewFileSet()
+	for _, fileName := range fileNames {
+		node, err := parser.ParseFile(fset, fileName, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			errs.add("embeds", fileName, err)
+			continue
+		}
+
+		for _, decl := range node.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.VAR {
+				continue
+			}
+
+			for _, spec := range genDecl.Specs {
+				valueSpec := spec.(*ast.ValueSpec)
+				doc := valueSpec.Doc
+				if doc == nil && len(genDecl.Specs) == 1 {
+					doc = genDecl.Doc
+				}
+				if doc == nil || len(valueSpec.Names) == 0 {
+					continue
+				}
+
+				for _, pattern := range embedPatterns(doc) {
+					embed := Embed{
+						File:     filepath.Base(fileName),
+						Line:     fset.Position(valueSpec.Pos()).Line,
+						Variable: valueSpec.Names[0].Name,
+						Pattern:  pattern,
+					}
+
+					resolved, err := resolveEmbedPattern(pkgDir, pattern)
+					if err != nil {
+						errs.add("embeds", fileName, err)
+					}
+					if len(resolved) == 0 {
+						results = append(results, embed)
+						continue
+					}
+					for _, file := range resolved {
+						embed.ResolvedFile = &file
+						results = append(results, embed)
+					}
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// embedPatterns returns the patterns of the //go:embed directives of a comment group
+func embedPatterns(doc *ast.CommentGroup) []string {
+	var patterns []string
+	for _, comment := range doc.List {
+		args, ok := strings.CutPrefix(comment.Text, "//go:embed ")
+		if !ok {
+			continue
+		}
+
+		for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+			var pattern string
+			if args[0] == '"' || args[0] == '`' {
+				end := strings.IndexByte(args[1:], args[0])
+				if end < 0 {
+					break
+				}
+				pattern, _ = strconv.Unquote(args[:end+2])
+				args = args[end+2:]
+			} else {
+				pattern, args, _ = strings.Cut(args, " ")
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// resolveEmbedPattern lists the files embedded by a pattern, relative to the package directory. Like
+// the go command, directories are embedded recursively without the files starting with . or _,
+// unless the pattern has the all: prefix.
+func resolveEmbedPattern(pkgDir, pattern string) ([]string, error) {
+	pattern, all := strings.CutPrefix(pattern, "all:")
+
+	matches, err := filepath.Glob(filepath.Join(pkgDir, filepath.FromSlash(pattern)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid embed pattern %q: %w", pattern, err)
+	}
+
+	var files []string
+	for _, match := range matches {
+		err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name := d.Name()
+			if path != match && !all && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(pkgDir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func populateEmbeds(ctx context.Context, db *sql.DB, pkgDir string, errs *collectorErrors) error {
+	embeds, err := collectEmbeds(pkgDir, errs)
+	if err != nil {
+		return fmt.Errorf("failed to collect embeds: %w", err)
+	}
+
+	for _, embed := range embeds {
+		insertSQL := `INSERT INTO embeds (file, line, variable, pattern, resolved_file) VALUES (?, ?, ?, ?, ?);`
+		_, err := db.ExecContext(ctx, insertSQL, embed.File, embed.Line, embed.Variable, embed.Pattern, embed.ResolvedFile)
+		if err != nil {
+			return fmt.Errorf("failed to insert embeds: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// packageExclusions tracks which packages matched the exclude_packages patterns of the config
+type packageExclusions struct {
+	patterns []string
+
+	// matched maps each pattern to the packages it excluded during collection
+	matched map[string]map[string]bool
+}
+
+func newPackageExclusions(patterns []string) *packageExclusions {
+	return &packageExclusions{patterns: patterns, matched: make(map[string]map[string]bool)}
+}
+
+// excluded reports whether the package matches any of the patterns, remembering the match
+func (e *packageExclusions) excluded(pkg string) bool {
+	for _, pattern := range e.patterns {
+		if matchPackage(pattern, pkg) {
+			if e.matched[pattern] == nil {
+				e.matched[pattern] = make(map[string]bool)
+			}
+			e.matched[pattern][pkg] = true
+			return true
+		}
+	}
+	return false
+}
+
+// filterEvents drops the test events of excluded packages
+func (e *packageExclusions) filterEvents(events []TestEvent) []TestEvent {
+	var result []TestEvent
+	for _, event := range events {
+		if event.Package != "" && e.excluded(event.Package) {
+			continue
+		}
+		result = append(result, event)
+	}
+	return result
+}
+
+// excludedDir reports whether the package in dir is excluded, resolving its import path like package_dirs
+func (e *packageExclusions) excludedDir(dir string) bool {
+	if len(e.patterns) == 0 {
+		return false
+	}
+
+	modules, err := listModules(dir)
+	if err != nil {
+		return false
+	}
+	pd, ok := resolvePackageDir(dir, modules)
+	return ok && e.excluded(pd.Package)
+}
+
+// prune deletes the rows of excluded packages from the coverage tables and, through package_dirs,
+// the code of their directories
+func (e *packageExclusions) prune(ctx context.Context, db *sql.DB) error {
+	if len(e.patterns) == 0 {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT package FROM all_coverage UNION SELECT package FROM test_coverage UNION SELECT package FROM package_dirs;")
+	if err != nil {
+		return fmt.Errorf("failed to query collected packages: %w", err)
+	}
+
+	var packages []string
+	for rows.Next() {
+		var pkg string
+		if err := rows.Scan(&pkg); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read collected packages: %w", err)
+		}
+		if e.excluded(pkg) {
+			packages = append(packages, pkg)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// all_code goes first, its rows are matched through package_dirs
+	statements := []string{
+		"DELETE FROM all_code WHERE package IN (SELECT dir FROM package_dirs WHERE package = ?);",
+		"DELETE FROM all_coverage WHERE package = ?;",
+		"DELETE FROM test_coverage WHERE package = ?;",
+		"DELETE FROM package_dirs WHERE package = ?;",
+	}
+	for _, pkg := range packages {
+		for _, stmt := range statements {
+			_, err := db.ExecContext(ctx, stmt, pkg)
+			if err != nil {
+				return fmt.Errorf("failed to prune excluded package %s: %w", pkg, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchPackage matches an import path against a pattern, where a trailing /... also matches subpackages
+func matchPackage(pattern, pkg string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+		return pkg == prefix || strings.HasPrefix(pkg, prefix+"/")
+	}
+	return pkg == pattern
+}
+
+// populateExcludedPackages records every pattern with the packages it excluded. Patterns
+// that matched nothing are kept with a NULL package so the config can be reconstructed.
+func populateExcludedPackages(ctx context.Context, db *sql.DB, e *packageExclusions) error {
+	insertSQL := `INSERT INTO excluded_packages (pattern, package) VALUES (?, ?);`
+	for _, pattern := range e.patterns {
+		if len(e.matched[pattern]) == 0 {
+			_, err := db.ExecContext(ctx, insertSQL, pattern, nil)
+			if err != nil {
+				return fmt.Errorf("failed to insert excluded packages: %w", err)
+			}
+			continue
+		}
+
+		packages := make([]string, 0, len(e.matched[pattern]))
+		for pkg := range e.matched[pattern] {
+			packages = append(packages, pkg)
+		}
+		sort.Strings(packages)
+
+		for _, pkg := range packages {
+			_, err := db.ExecContext(ctx, insertSQL, pattern, pkg)
+			if err != nil {
+				return fmt.Errorf("failed to insert excluded packages: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// countExcludedPackages returns how many packages were intentionally excluded from a database
+func countExcludedPackages(ctx context.Context, db *sql.DB) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT count(DISTINCT package) FROM excluded_packages;").Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count excluded packages: %w", err)
+	}
+	return n, nil
+}
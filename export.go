@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// failureLocationRegexp captures the file and line of messages logged by t.Error and friends
+var failureLocationRegexp = regexp.MustCompile(`^([\w.\-]+\.go):(\d+): (.*)$`)
+
+// LSP diagnostic severities
+const (
+	severityError       = 1
+	severityInformation = 3
+)
+
+// FileDiagnostics has the shape of the LSP textDocument/publishDiagnostics parameters, so editor
+// integrations can forward it as is
+type FileDiagnostics struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Diagnostic is an LSP diagnostic, lines and characters are zero based
+type Diagnostic struct {
+	Range    DiagnosticRange `json:"range"`
+	Severity int             `json:"severity"`
+	Source   string          `json:"source"`
+	Message  string          `json:"message"`
+}
+
+type DiagnosticRange struct {
+	Start DiagnosticPosition `json:"start"`
+	End   DiagnosticPosition `json:"end"`
+}
+
+type DiagnosticPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+func exportCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	format := flags.String("format", "gopls-diagnostics", "export format (gopls-diagnostics)")
+	output := flags.String("o", "", "file the export is written to (default stdout)")
+	flags.Parse(args)
+
+	if *format != "gopls-diagnostics" {
+		return fmt.Errorf("invalid value for --format: %q", *format)
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	diagnostics, err := collectDiagnostics(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diagnostics)
+}
+
+// collectDiagnostics flags the uncovered blocks and the lines where failing tests reported an
+// error, grouped by file. Paths are resolved against the package directory of the run.
+func collectDiagnostics(ctx context.Context, db *sql.DB) ([]FileDiagnostics, error) {
+	metadata, err := loadRunMetadata(ctx, db, "")
+	if err != nil {
+		return nil, err
+	}
+	pkgDir := metadata["package"]
+
+	files := make(map[string][]Diagnostic)
+
+	rows, err := db.QueryContext(ctx, `SELECT file, function_name, start_line, start_col, end_line, end_col FROM all_coverage WHERE count = 0 ORDER BY file, start_line;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query uncovered code: %w", err)
+	}
+	for rows.Next() {
+		var file, function string
+		var startLine, startCol, endLine, endCol int
+		if err := rows.Scan(&file, &function, &startLine, &startCol, &endLine, &endCol); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read uncovered code: %w", err)
+		}
+
+		message := "not covered by any test"
+		if function != "" {
+			message = fmt.Sprintf("%s: %s", function, message)
+		}
+		files[file] = append(files[file], Diagnostic{
+			Range: DiagnosticRange{
+				Start: DiagnosticPosition{Line: startLine - 1, Character: startCol - 1},
+				End:   DiagnosticPosition{Line: endLine - 1, Character: endCol - 1},
+			},
+			Severity: severityInformation,
+			Source:   "tq",
+			Message:  message,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT test, output FROM test_failures ORDER BY test;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query test failures: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var test, output string
+		if err := rows.Scan(&test, &output); err != nil {
+			return nil, fmt.Errorf("failed to read test failures: %w", err)
+		}
+
+		for _, line := range strings.Split(output, "\n") {
+			m := failureLocationRegexp.FindStringSubmatch(strings.TrimSpace(line))
+			if m == nil {
+				continue
+			}
+			lineNumber, _ := strconv.Atoi(m[2])
+			files[m[1]] = append(files[m[1]], Diagnostic{
+				Range: DiagnosticRange{
+					Start: DiagnosticPosition{Line: lineNumber - 1},
+					End:   DiagnosticPosition{Line: lineNumber},
+				},
+				Severity: severityError,
+				Source:   "tq",
+				Message:  fmt.Sprintf("%s failed: %s", test, m[3]),
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]FileDiagnostics, 0, len(names))
+	for _, name := range names {
+		result = append(result, FileDiagnostics{
+			URI:         "file://" + filepath.ToSlash(filepath.Join(pkgDir, name)),
+			Diagnostics: files[name],
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// outputMatchWeight discounts matches found only in the failure output compared to matches in the test name
+const outputMatchWeight = 0.6
+
+// TestMatch represents a test matching a fuzzy lookup
+type TestMatch struct {
+	Package string
+	Test    string
+	Status  string
+	Score   float64
+}
+
+func findTestCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("find-test", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	limit := flags.Int("limit", 10, "maximum number of tests listed")
+	threshold := flags.Float64("threshold", 0.3, "minimum score between 0 and 1 for a test to be listed")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), `Usage of find-test: tq find-test [flags] "search terms"`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	search := strings.Join(flags.Args(), " ")
+	if strings.TrimSpace(search) == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	matches, err := findTests(ctx, db, search, *threshold)
+	if err != nil {
+		return err
+	}
+	if len(matches) > *limit {
+		matches = matches[:*limit]
+	}
+
+	if len(matches) == 0 {
+		fmt.Printf("no tests matching %q\n", search)
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"score", "package", "test", "status"})
+	for _, m := range matches {
+		t.AppendRow(table.Row{fmt.Sprintf("%.2f", m.Score), m.Package, m.Test, m.Status})
+	}
+	t.Render()
+
+	return nil
+}
+
+// findTests scores every test against the search terms and returns the matches sorted by score
+func findTests(ctx context.Context, db *sql.DB, search string, threshold float64) ([]TestMatch, error) {
+	query := `SELECT t.package, t.test, t.action, ifnull(f.output, '') FROM all_tests t LEFT JOIN test_failures f ON f.package = t.package AND f.test = t.test;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tests: %w", err)
+	}
+	defer rows.Close()
+
+	searchTrigrams := trigrams(search)
+	if len(searchTrigrams) == 0 {
+		return nil, nil
+	}
+
+	var matches []TestMatch
+	for rows.Next() {
+		var m TestMatch
+		var output string
+		if err := rows.Scan(&m.Package, &m.Test, &m.Status, &output); err != nil {
+			return nil, fmt.Errorf("failed to read test: %w", err)
+		}
+
+		m.Score = max(similarity(searchTrigrams, trigrams(m.Test)), outputMatchWeight*similarity(searchTrigrams, trigrams(output)))
+		if m.Score >= threshold {
+			matches = append(matches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tests: %w", err)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Test < matches[j].Test
+	})
+	return matches, nil
+}
+
+// similarity returns the fraction of the search trigrams found in the candidate
+func similarity(search, candidate map[string]bool) float64 {
+	if len(search) == 0 {
+		return 0
+	}
+
+	found := 0
+	for t := range search {
+		if candidate[t] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(search))
+}
+
+// trigrams returns the set of trigrams of the words in s, similar to pg_trgm: words are lower cased
+// and padded with two spaces in front and one at the end. CamelCase identifiers are split into words.
+func trigrams(s string) map[string]bool {
+	result := make(map[string]bool)
+	for _, word := range splitWords(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			result[string(padded[i:i+3])] = true
+		}
+	}
+	return result
+}
+
+// splitWords splits s on non alphanumeric characters and lower to upper case transitions
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	prev := rune(0)
+	for _, r := range s {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			if len(current) > 0 {
+				words = append(words, strings.ToLower(string(current)))
+				current = current[:0]
+			}
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) && len(current) > 0:
+			words = append(words, strings.ToLower(string(current)))
+			current = append(current[:0], r)
+		default:
+			current = append(current, r)
+		}
+		prev = r
+	}
+	if len(current) > 0 {
+		words = append(words, strings.ToLower(string(current)))
+	}
+	return words
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+func fsckCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	dbFile := flags.String("dbfile", "testquery.db", "database file to check")
+	configFile := flags.String("config", defaultConfigFile, "config file the database is checked against")
+	flags.Parse(args)
+
+	if _, err := os.Stat(*dbFile); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open(sqliteDriver, *dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	problems, err := checkExclusionDrift(ctx, db, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s drifted from %s: %d problem(s)", *dbFile, *configFile, len(problems))
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+// checkExclusionDrift compares the exclude_packages of the config with the exclusions recorded
+// in the database and looks for data of packages the config excludes
+func checkExclusionDrift(ctx context.Context, db *sql.DB, cfg Config) ([]string, error) {
+	recorded := make(map[string]bool)
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT pattern FROM excluded_packages;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query excluded packages: %w", err)
+	}
+	for rows.Next() {
+		var pattern string
+		if err := rows.Scan(&pattern); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read excluded packages: %w", err)
+		}
+		recorded[pattern] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	configured := make(map[string]bool)
+	for _, pattern := range cfg.ExcludePackages {
+		configured[pattern] = true
+		if !recorded[pattern] {
+			problems = append(problems, fmt.Sprintf("pattern %s is excluded by the config but not by the database", pattern))
+		}
+	}
+
+	var stale []string
+	for pattern := range recorded {
+		if !configured[pattern] {
+			stale = append(stale, pattern)
+		}
+	}
+	sort.Strings(stale)
+	for _, pattern := range stale {
+		problems = append(problems, fmt.Sprintf("pattern %s is excluded by the database but no longer by the config", pattern))
+	}
+
+	exclusions := newPackageExclusions(cfg.ExcludePackages)
+	rows, err = db.QueryContext(ctx, "SELECT package FROM all_tests UNION SELECT package FROM all_coverage ORDER BY 1;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query packages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pkg string
+		if err := rows.Scan(&pkg); err != nil {
+			return nil, fmt.Errorf("failed to read packages: %w", err)
+		}
+		if exclusions.excluded(pkg) {
+			problems = append(problems, fmt.Sprintf("package %s is excluded by the config but has data in the database", pkg))
+		}
+	}
+
+	return problems, rows.Err()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GenericFunction represents a type-parameterized function or a method of a generic type. Coverage
+// profiles have a single set of blocks for its body, shared by every instantiation.
+type GenericFunction struct {
+	File           string   `json:"file"`
+	FunctionName   string   `json:"function_name"`
+	Receiver       string   `json:"receiver"`
+	TypeParams     string   `json:"type_params"`
+	StartLine      int      `json:"start_line"`
+	EndLine        int      `json:"end_line"`
+	Instantiations []string `json:"instantiations"`
+}
+
+// collectGenericFunctions finds the generic functions of the package and, by type checking it with
+// its tests, the instantiations they are used with
+func collectGenericFunctions(pkgDir string, errs *collectorErrors) ([]GenericFunction, error) {
+	fileNames, err := filepath.Glob(filepath.Join(pkgDir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	var results []GenericFunction
+	// decls and receivers map generic functions and generic types to the indexes of
+	// their declarations, respectively of their methods, in results
+	decls := make(map[token.Pos][]int)
+	receivers := make(map[string][]int)
+
+	for _, fileName := range fileNames {
+		node, err := parser.ParseFile(fset, fileName, nil, parser.SkipObjectResolution)
+		if err != nil {
+			errs.add("generics", fileName, err)
+			continue
+		}
+		if strings.HasSuffix(node.Name.Name, "_test") {
+			continue
+		}
+		files = append(files, node)
+		if strings.HasSuffix(fileName, "_test.go") {
+			continue
+		}
+
+		for _, decl := range node.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+
+			fn := GenericFunction{
+				File:         filepath.Base(fileName),
+				FunctionName: funcDecl.Name.Name,
+				StartLine:    fset.Position(funcDecl.Pos()).Line,
+				EndLine:      fset.Position(funcDecl.End()).Line,
+			}
+
+			switch {
+			case funcDecl.Type.TypeParams != nil:
+				fn.TypeParams = typeParams(funcDecl.Type.TypeParams)
+				decls[funcDecl.Name.Pos()] = append(decls[funcDecl.Name.Pos()], len(results))
+			case funcDecl.Recv != nil:
+				recv, params := genericReceiver(funcDecl.Recv.List[0].Type)
+				if recv == "" {
+					continue
+				}
+				fn.Receiver, fn.TypeParams = recv, params
+				receivers[recv] = append(receivers[recv], len(results))
+			default:
+				continue
+			}
+			results = append(results, fn)
+		}
+	}
+
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	info := &types.Info{
+		Instances: make(map[*ast.Ident]types.Instance),
+		Uses:      make(map[*ast.Ident]types.Object),
+	}
+	var typeErr error
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			if typeErr == nil {
+				typeErr = err
+			}
+		},
+	}
+	conf.Check(files[0].Name.Name, fset, files, info)
+	if typeErr != nil {
+		errs.add("generics", pkgDir, fmt.Errorf("instantiations may be incomplete: %w", typeErr))
+	}
+
+	seen := make(map[int]map[string]bool)
+	for ident, instance := range info.Instances {
+		obj := info.Uses[ident]
+		if obj == nil {
+			continue
+		}
+
+		var targets []int
+		switch obj := obj.(type) {
+		case *types.Func:
+			targets = decls[obj.Pos()]
+		case *types.TypeName:
+			targets = receivers[obj.Name()]
+		}
+
+		// instances made of type parameters, like the *Stack[T] receivers, are not instantiations
+		args := make([]string, instance.TypeArgs.Len())
+		generic := false
+		for i := range args {
+			arg := instance.TypeArgs.At(i)
+			if _, ok := arg.(*types.TypeParam); ok {
+				generic = true
+			}
+			args[i] = types.TypeString(arg, types.RelativeTo(obj.Pkg()))
+		}
+		if generic {
+			continue
+		}
+		name := ident.Name + "[" + strings.Join(args, ", ") + "]"
+
+		for _, i := range targets {
+			if seen[i] == nil {
+				seen[i] = make(map[string]bool)
+			}
+			if !seen[i][name] {
+				seen[i][name] = true
+				results[i].Instantiations = append(results[i].Instantiations, name)
+			}
+		}
+	}
+
+	for i := range results {
+		sort.Strings(results[i].Instantiations)
+	}
+	return results, nil
+}
+
+// genericReceiver returns the type name and the type parameters of a receiver like *Stack[T]
+func genericReceiver(expr ast.Expr) (string, string) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+
+	var base ast.Expr
+	var params []ast.Expr
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		base, params = e.X, []ast.Expr{e.Index}
+	case *ast.IndexListExpr:
+		base, params = e.X, e.Indices
+	default:
+		return "", ""
+	}
+
+	ident, ok := base.(*ast.Ident)
+	if !ok {
+		return "", ""
+	}
+
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = types.ExprString(p)
+	}
+	return ident.Name, "[" + strings.Join(names, ", ") + "]"
+}
+
+// typeParams formats a type parameter list like [K comparable, V any]
+func typeParams(list *ast.FieldList) string {
+	var params []string
+	for _, field := range list.List {
+		for _, name := range field.Names {
+			params = append(params, name.Name+" "+types.ExprString(field.Type))
+		}
+	}
+	return "[" + strings.Join(params, ", ") + "]"
+}
+
+func populateGenericFunctions(ctx context.Context, db *sql.DB, pkgDir string, errs *collectorErrors) error {
+	functions, err := collectGenericFunctions(pkgDir, errs)
+	if err != nil {
+		return fmt.Errorf("failed to collect generic functions: %w", err)
+	}
+
+	for _, fn := range functions {
+		var instantiations *string
+		if len(fn.Instantiations) > 0 {
+			s := strings.Join(fn.Instantiations, ", ")
+			instantiations = &s
+		}
+
+		var receiver *string
+		if fn.Receiver != "" {
+			receiver = &fn.Receiver
+		}
+
+		insertSQL := `INSERT INTO generic_functions (file, function_name, receiver, type_params, start_line, end_line, instantiations) VALUES (?, ?, ?, ?, ?, ?, ?);`
+		_, err := db.ExecContext(ctx, insertSQL, fn.File, fn.FunctionName, receiver, fn.TypeParams, fn.StartLine, fn.EndLine, instantiations)
+		if err != nil {
+			return fmt.Errorf("failed to insert generic functions: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// runHook runs a shell command, forwarding its output to stderr, and returns how long it took
+func runHook(ctx context.Context, command string) (time.Duration, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	return time.Since(start), err
+}
+
+// detectTestMain reports whether the test files of the package declare a TestMain function
+func detectTestMain(pkgDir string) (bool, error) {
+	files, err := filepath.Glob(filepath.Join(pkgDir, "*_test.go"))
+	if err != nil {
+		return false, err
+	}
+
+	fs := token.NewFileSet()
+	for _, fileName := range files {
+		node, err := parser.ParseFile(fs, fileName, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse file: %w", err)
+		}
+
+		for _, decl := range node.Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Recv == nil && funcDecl.Name.Name == "TestMain" {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const queryAdviceDDL = `CREATE TABLE IF NOT EXISTS query_advice (
+		created_at TIMESTAMP NOT NULL,
+		query TEXT NOT NULL,
+		elapsed NUMERIC NOT NULL,
+		table_name TEXT NOT NULL,
+		suggestion TEXT NOT NULL,
+		applied BOOLEAN NOT NULL
+	);`
+
+var (
+	// automaticIndexRegexp matches the query plan steps where SQLite builds a throwaway index, which
+	// is exactly the index the query is missing
+	automaticIndexRegexp = regexp.MustCompile(`^(?:SEARCH|SCAN) (\w+) USING AUTOMATIC (?:PARTIAL )?(?:COVERING )?INDEX \(([^)]*)\)`)
+
+	// indexColumnRegexp matches the constrained columns of an automatic index, like file=? or start_line>?
+	indexColumnRegexp = regexp.MustCompile(`(\w+)\s*[=<>]`)
+
+	// tableAliasRegexp matches the tables of FROM and JOIN clauses with their optional alias
+	tableAliasRegexp = regexp.MustCompile(`(?i)\b(?:from|join)\s+(\w+)(?:\s+(?:as\s+)?(\w+))?`)
+)
+
+// aliasKeywords are the words that may follow a table name without being its alias
+var aliasKeywords = map[string]bool{
+	"where": true, "on": true, "using": true, "join": true, "left": true, "right": true, "inner": true,
+	"outer": true, "cross": true, "natural": true, "full": true, "group": true, "order": true, "limit": true,
+	"union": true, "except": true, "intersect": true, "window": true, "having": true, "as": true,
+}
+
+// indexAdvice is an index suggested for a slow query
+type indexAdvice struct {
+	table   string
+	columns []string
+}
+
+func (a indexAdvice) name() string {
+	return "idx_" + a.table + "_" + strings.Join(a.columns, "_")
+}
+
+func (a indexAdvice) sql() string {
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s);", a.name(), a.table, strings.Join(a.columns, ", "))
+}
+
+// adviseIndexes explains a slow query and suggests, or creates when autoIndex is set, the indexes
+// SQLite had to build on the fly. The suggestions are recorded in the query_advice table.
+func adviseIndexes(ctx context.Context, db *sql.DB, query string, elapsed time.Duration, autoIndex bool) ([]string, error) {
+	advice, err := collectIndexAdvice(ctx, db, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+	for _, a := range advice {
+		if autoIndex {
+			_, err := db.ExecContext(ctx, a.sql())
+			if err != nil {
+				return nil, fmt.Errorf("failed to create index %s: %w", a.name(), err)
+			}
+			messages = append(messages, fmt.Sprintf("query took %s, created %s", elapsed.Round(time.Millisecond), a.sql()))
+		} else {
+			messages = append(messages, fmt.Sprintf("query took %s, consider %s", elapsed.Round(time.Millisecond), a.sql()))
+		}
+	}
+
+	err = recordIndexAdvice(ctx, db, query, elapsed, advice, autoIndex)
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// recordIndexAdvice writes the suggestions for a query to the query_advice table. The table is only
+// created once there is a suggestion, a slow query the advisor can't help with leaves the database as is.
+func recordIndexAdvice(ctx context.Context, db *sql.DB, query string, elapsed time.Duration, advice []indexAdvice, applied bool) error {
+	if len(advice) == 0 {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, queryAdviceDDL)
+	if err != nil {
+		return fmt.Errorf("failed to create query_advice table: %w", err)
+	}
+
+	now := time.Now()
+	for _, a := range advice {
+		insertSQL := `INSERT INTO query_advice (created_at, query, elapsed, table_name, suggestion, applied) VALUES (?, ?, ?, ?, ?, ?);`
+		_, err := db.ExecContext(ctx, insertSQL, now, query, elapsed.Seconds(), a.table, a.sql(), applied)
+		if err != nil {
+			return fmt.Errorf("failed to insert query advice: %w", err)
+		}
+	}
+	return nil
+}
+
+// collectIndexAdvice reads the query plan looking for automatic indexes on tables
+func collectIndexAdvice(ctx context.Context, db *sql.DB, query string) ([]indexAdvice, error) {
+	aliases, err := resolveAliases(ctx, db, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain query: %w", err)
+	}
+	defer rows.Close()
+
+	var advice []indexAdvice
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return nil, fmt.Errorf("failed to read query plan: %w", err)
+		}
+
+		m := automaticIndexRegexp.FindStringSubmatch(detail)
+		if m == nil {
+			continue
+		}
+		table, ok := aliases[strings.ToLower(m[1])]
+		if !ok {
+			continue
+		}
+
+		a := indexAdvice{table: table}
+		for _, c := range indexColumnRegexp.FindAllStringSubmatch(m[2], -1) {
+			a.columns = append(a.columns, c[1])
+		}
+		if len(a.columns) == 0 || seen[a.name()] {
+			continue
+		}
+		seen[a.name()] = true
+		advice = append(advice, a)
+	}
+
+	return advice, rows.Err()
+}
+
+// resolveAliases maps the names and aliases used in the query, and in the views it may
+// reference, to the tables they stand for. Views and CTEs are left out since they can't be indexed.
+func resolveAliases(ctx context.Context, db *sql.DB, query string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT type, name, ifnull(sql, '') FROM sqlite_master WHERE type IN ('table', 'view');")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	tables := make(map[string]bool)
+	text := query
+	for rows.Next() {
+		var kind, name, ddl string
+		if err := rows.Scan(&kind, &name, &ddl); err != nil {
+			return nil, fmt.Errorf("failed to read table name: %w", err)
+		}
+		if kind == "table" {
+			tables[strings.ToLower(name)] = true
+		} else {
+			text += "\n" + ddl
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	aliases := make(map[string]string)
+	for name := range tables {
+		aliases[name] = name
+	}
+	for _, m := range tableAliasRegexp.FindAllStringSubmatch(text, -1) {
+		table, alias := strings.ToLower(m[1]), strings.ToLower(m[2])
+		if tables[table] && alias != "" && !aliasKeywords[alias] {
+			aliases[alias] = table
+		}
+	}
+	return aliases, nil
+}
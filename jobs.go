@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// slowTestThreshold is the average test duration above which running tests, rather than
+	// building them, dominates per-test collection and --jobs auto uses every CPU
+	slowTestThreshold = time.Second
+
+	// loadPollInterval is how often a waiting job checks the load average again
+	loadPollInterval = 500 * time.Millisecond
+)
+
+// parseJobs converts the value of --jobs into a number of concurrent per-test runs. With auto, the
+// number is sized from the CPU count: go test compiles in parallel, so fast tests get half of the
+// CPUs and only suites whose tests take long on average get all of them.
+func parseJobs(value string, testResults []TestEvent) (int, bool, error) {
+	if value == "auto" {
+		var total float64
+		for _, test := range testResults {
+			if test.Elapsed != nil {
+				total += *test.Elapsed
+			}
+		}
+
+		jobs := runtime.NumCPU() / 2
+		if len(testResults) > 0 && total/float64(len(testResults)) >= slowTestThreshold.Seconds() {
+			jobs = runtime.NumCPU()
+		}
+		return max(jobs, 1), true, nil
+	}
+
+	// subcommands without a --jobs flag collect sequentially
+	if value == "" {
+		return 1, false, nil
+	}
+
+	jobs, err := strconv.Atoi(value)
+	if err != nil || jobs <= 0 {
+		return 0, false, fmt.Errorf("invalid value for --jobs: %q", value)
+	}
+	return jobs, false, nil
+}
+
+// jobLimiter bounds the number of concurrent jobs. When adaptive, new jobs also wait while the
+// machine is overloaded, i.e. its load average exceeds the CPU count, but one job always runs.
+type jobLimiter struct {
+	mu       sync.Mutex
+	max      int
+	active   int
+	adaptive bool
+}
+
+func (l *jobLimiter) acquire() {
+	for {
+		l.mu.Lock()
+		if l.active < l.max && (l.active == 0 || !l.adaptive || !overloaded()) {
+			l.active++
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+		time.Sleep(loadPollInterval)
+	}
+}
+
+func (l *jobLimiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+}
+
+// overloaded reports whether the one minute load average exceeds the number of CPUs
+func overloaded() bool {
+	load, ok := loadAverage()
+	return ok && load > float64(runtime.NumCPU())
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// hugeTableRows is the row count above which SELECT * without a LIMIT triggers a warning
+const hugeTableRows = 10000
+
+var (
+	selectStarRegexp = regexp.MustCompile(`(?i)\bselect\s+(?:distinct\s+|all\s+)?\*`)
+	limitRegexp      = regexp.MustCompile(`(?i)\blimit\s+\d+`)
+)
+
+// lintQuery analyzes a user query and returns warnings about patterns that are likely to be slow or wrong
+func lintQuery(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	tables, err := referencedTables(ctx, db, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+
+	// all_code has one row per line of code, joining it to coverage blocks without restricting
+	// the line range multiplies every line by every block. Only tables joined by the same SELECT count.
+	for _, clause := range fromClauses(query) {
+		joined := make(map[string]bool)
+		hasRange := false
+		for i, token := range clause {
+			switch token {
+			case "between", "start_line", "end_line":
+				hasRange = true
+			}
+			if i == 0 || clause[i-1] == "join" || clause[i-1] == "," {
+				joined[token] = tables[token]
+			}
+		}
+		if !joined["all_code"] || hasRange {
+			continue
+		}
+		for _, coverage := range []string{"all_coverage", "test_coverage"} {
+			if joined[coverage] {
+				warnings = append(warnings, fmt.Sprintf("join between all_code and %s has no line range predicate (e.g. line_number BETWEEN start_line AND end_line), this is likely a cartesian product", coverage))
+			}
+		}
+	}
+
+	if selectStarRegexp.MatchString(query) && !limitRegexp.MatchString(query) {
+		for name := range tables {
+			var count int
+			err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %q;", name)).Scan(&count)
+			if err != nil {
+				return nil, fmt.Errorf("failed to count rows of %s: %w", name, err)
+			}
+			if count > hugeTableRows {
+				warnings = append(warnings, fmt.Sprintf("SELECT * on %s returns up to %d rows, consider selecting fewer columns or adding a LIMIT", name, count))
+			}
+		}
+	}
+
+	return warnings, nil
+}
+
+// referencedTables returns the set of tables (not views) whose names appear in the query
+func referencedTables(ctx context.Context, db *sql.DB, query string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table';")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	known := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read table name: %w", err)
+		}
+		known[strings.ToLower(name)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	tables := make(map[string]bool)
+	for _, ident := range identifierRegexp.FindAllString(query, -1) {
+		if name := strings.ToLower(ident); known[name] {
+			tables[name] = true
+		}
+	}
+	return tables, nil
+}
+
+// clauseEnd holds the keywords ending the FROM and WHERE clauses of a SELECT
+var clauseEnd = map[string]bool{"group": true, "order": true, "limit": true, "having": true, "window": true}
+
+// compoundOperators separate the SELECTs of a compound query
+var compoundOperators = map[string]bool{"union": true, "intersect": true, "except": true}
+
+// fromClauses splits a query into its SELECTs, subqueries included, and returns the lowercase tokens
+// following the FROM keyword of each one up to the end of its WHERE clause. Parenthesized expressions
+// are replaced by a single "(" token, so the tables of a subquery belong to the subquery only.
+func fromClauses(query string) [][]string {
+	// groups holds the tokens of the top level query and of every parenthesized expression
+	groups := [][]string{nil}
+	stack := []int{0}
+	emit := func(token string) {
+		current := stack[len(stack)-1]
+		groups[current] = append(groups[current], token)
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		case strings.HasPrefix(query[i:], "--"):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 3
+			}
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			start := i + 1
+			for i++; i < len(query) && query[i] != closing; i++ {
+			}
+			if c == '\'' {
+				emit("'")
+			} else {
+				emit(strings.ToLower(query[start:min(i, len(query))]))
+			}
+		case c == '(':
+			emit("(")
+			groups = append(groups, nil)
+			stack = append(stack, len(groups)-1)
+		case c == ')':
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			start := i
+			for i+1 < len(query) && isIdentifierByte(query[i+1]) {
+				i++
+			}
+			emit(strings.ToLower(query[start : i+1]))
+		default:
+			emit(string(c))
+		}
+	}
+
+	var clauses [][]string
+	for _, tokens := range groups {
+		var clause []string
+		inFrom := false
+		for _, token := range tokens {
+			switch {
+			case compoundOperators[token] || clauseEnd[token]:
+				inFrom = false
+			case token == "from":
+				if clause != nil {
+					clauses = append(clauses, clause)
+				}
+				clause, inFrom = []string{}, true
+			case inFrom:
+				clause = append(clause, token)
+			}
+		}
+		if clause != nil {
+			clauses = append(clauses, clause)
+		}
+	}
+	return clauses
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
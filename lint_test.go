@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLintQueryCartesianJoin(t *testing.T) {
+	db := newTestDatabase(t)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "join without range",
+			query: "SELECT ac.file FROM all_code ac JOIN all_coverage cov ON ac.file = cov.file",
+			want:  []string{"all_coverage"},
+		},
+		{
+			name:  "join with range",
+			query: "SELECT ac.file FROM all_code ac JOIN all_coverage cov ON ac.file = cov.file AND ac.line_number BETWEEN cov.start_line AND cov.end_line",
+		},
+		{
+			name:  "range in where clause",
+			query: "SELECT ac.file FROM all_code ac, test_coverage tc WHERE ac.line_number >= tc.start_line AND ac.line_number <= tc.end_line",
+		},
+		{
+			name:  "range column only selected",
+			query: "SELECT tc.start_line FROM all_code ac, test_coverage tc",
+			want:  []string{"test_coverage"},
+		},
+		{
+			name:  "independent scalar subqueries",
+			query: "SELECT (SELECT count(*) FROM all_code), (SELECT count(*) FROM all_coverage)",
+		},
+		{
+			name:  "range in another select",
+			query: "SELECT * FROM all_code, all_coverage WHERE all_code.file IN (SELECT file FROM test_coverage WHERE start_line > 1) LIMIT 1",
+			want:  []string{"all_coverage"},
+		},
+		{
+			name:  "cartesian subquery",
+			query: `SELECT count(*) FROM (SELECT * FROM "all_code", test_coverage) -- between`,
+			want:  []string{"test_coverage"},
+		},
+		{
+			name:  "compound select",
+			query: "SELECT file FROM all_code UNION SELECT file FROM all_coverage",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := lintQuery(context.Background(), db, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, w := range warnings {
+				if strings.HasPrefix(w, "join between all_code and ") {
+					got = append(got, strings.Fields(w)[4])
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("lintQuery(%q) warned about %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
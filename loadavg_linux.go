@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadAverage returns the one minute load average
+func loadAverage() (float64, bool) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+
+	load, err := strconv.ParseFloat(fields[0], 64)
+	return load, err == nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// loadAverage is not implemented on this platform, jobs never back off
+func loadAverage() (float64, bool) {
+	return 0, false
+}
@@ -10,22 +10,95 @@ import (
 	"log"
 	"os"
 	"strings"
-
-	_ "github.com/mattn/go-sqlite3"
-
-	"github.com/chzyer/readline"
-	"github.com/jedib0t/go-pretty/v6/table"
+	"time"
 )
 
 var Version = "dev"
 
+// options holds the command line configuration of a tq session
+type options struct {
+	pkgDir          string
+	persist         bool
+	open            bool
+	dbFile          string
+	query           string
+	trackUsage      bool
+	raw             bool
+	shuffle         string
+	parallel        int
+	noLint          bool
+	noTTY           bool
+	configFile      string
+	maxCellBytes    int
+	full            bool
+	setupCmd        string
+	teardownCmd     string
+	perTestStrategy string
+	slowQuery       time.Duration
+	autoIndex       bool
+	extensions      stringList
+	strict          bool
+	noVacuum        bool
+	jobs            string
+	sinks           stringList
+}
+
+// commands maps the name of each subcommand to its entry point, the remaining
+// arguments being parsed by the subcommand itself
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"ask":            askCmd,
+	"baseline":       baselineCmd,
+	"bench-queries":  benchQueriesCmd,
+	"bundle-failure": bundleFailureCmd,
+	"check":          checkCmd,
+	"clean":          cleanCmd,
+	"daemon":         daemonCmd,
+	"diff":           diffCmd,
+	"export":         exportCmd,
+	"find-test":      findTestCmd,
+	"fsck":           fsckCmd,
+	"query":          queryCmd,
+	"report":         reportCmd,
+	"rerun":          rerunCmd,
+	"review":         reviewCmd,
+	"schema":         schemaCmd,
+	"select":         selectCmd,
+	"shard-plan":     shardPlanCmd,
+	"suggest":        suggestCmd,
+}
+
 func main() {
-	pkgDir := flag.String("pkg", ".", "directory of the package to test")
-	persist := flag.Bool("persist", false, "persist database between runs")
-	dbFile := flag.String("dbfile", "testquery.db", "database file name for use with --persist and --open")
-	openDB := flag.Bool("open", false, "open a database from a previous run")
-	query := flag.String("query", "", "runs a single query and returns the result")
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			err := cmd(context.Background(), os.Args[2:])
+			if err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+	}
+
+	var opts options
+	flag.StringVar(&opts.pkgDir, "pkg", ".", "directory of the package to test")
+	flag.BoolVar(&opts.persist, "persist", false, "persist database between runs")
+	flag.BoolVar(&opts.noVacuum, "no-vacuum", false, "persist with a fast page copy instead of VACUUM INTO, which compacts the database but is slow on huge ones")
+	flag.Var(&opts.sinks, "sink", "write the results to sqlite (the --dbfile), stdout-json or an http(s) URL receiving JSON lines, then exit unless --query is given (repeatable)")
+	flag.StringVar(&opts.dbFile, "dbfile", "testquery.db", "database file name for use with --persist and --open")
+	flag.BoolVar(&opts.open, "open", false, "open a database from a previous run")
+	flag.BoolVar(&opts.strict, "strict", false, "fail when any file could not be collected (see the collector_errors table)")
+	flag.StringVar(&opts.configFile, "config", defaultConfigFile, "config file declaring extra ddl and post-build sql")
+	flag.Var(&opts.extensions, "sqlite-extension", "load a SQLite extension into every connection (repeatable)")
+	flag.StringVar(&opts.query, "query", "", "runs a single query and returns the result")
 	version := flag.Bool("version", false, "shows version information")
+	addQueryFlags(flag.CommandLine, &opts)
+	flag.BoolVar(&opts.trackUsage, "track-usage", false, "record which tables and views are queried in the usage table")
+	flag.BoolVar(&opts.noTTY, "no-tty", false, "read statements line by line without terminal features (automatic when stdin is not a terminal)")
+	flag.StringVar(&opts.shuffle, "shuffle", "off", "value of go test -shuffle used when collecting test results (off, on or a seed)")
+	flag.StringVar(&opts.setupCmd, "setup-cmd", "", "shell command run once before collecting test results, e.g. to start shared services")
+	flag.StringVar(&opts.teardownCmd, "teardown-cmd", "", "shell command run once after collecting test results")
+	flag.StringVar(&opts.jobs, "jobs", "1", "number of tests run concurrently to collect per-test coverage, or auto to size it from the CPU count and back off when the machine is loaded")
+	flag.StringVar(&opts.perTestStrategy, "per-test-strategy", perTestProcess, "how per-test coverage is collected: process runs go test for each test, binary builds the test binary once and runs all the tests in it, taking a coverage snapshot after each test")
+	flag.IntVar(&opts.parallel, "parallel", 0, "value of go test -parallel used when collecting test results (defaults to GOMAXPROCS)")
 	flag.Parse()
 
 	if *version {
@@ -35,102 +108,232 @@ func main() {
 
 	ctx := context.Background()
 
-	rl, err := readline.NewEx(&readline.Config{
-		Prompt:                 "> ",
-		HistoryFile:            "/tmp/testquery-history",
-		DisableAutoSaveHistory: true,
-	})
-	if err != nil {
-		log.Fatalln(err)
-	}
-	defer rl.Close()
-
-	err = run(ctx, *pkgDir, rl, *persist, *openDB, *dbFile, *query)
+	err := run(ctx, opts)
 	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, context.Canceled) {
 		log.Fatalln(err)
 	}
 }
 
-func run(ctx context.Context, pkgDir string, rl *readline.Instance, persist, open bool, dbFile string, query string) error {
-	var db *sql.DB
-	var err error
+func run(ctx context.Context, opts options) (err error) {
+	sinks, err := newSinks(opts)
+	if err != nil {
+		return err
+	}
+
+	// fail before running the tests rather than after
+	_, _, err = parseJobs(opts.jobs, nil)
+	if err != nil {
+		return err
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
 
-	if open {
-		db, err = sql.Open("sqlite3", dbFile)
+	if opts.trackUsage {
+		err = createUsageTable(ctx, db)
 		if err != nil {
-			return fmt.Errorf("failed to open database: %w", err)
+			return fmt.Errorf("failed to create usage table: %w", err)
 		}
-		defer db.Close()
-	} else {
-		db, err = sql.Open("sqlite3", ":memory:")
-		if err != nil {
-			return fmt.Errorf("failed to instantiate sqlite: %w", err)
+	}
+
+	if opts.persist {
+		defer func() {
+			perr := persistDatabase(ctx, db, opts.dbFile, opts.noVacuum)
+			if perr != nil && (err == nil || errors.Is(err, io.EOF)) {
+				err = perr
+			}
+		}()
+	}
+
+	if len(sinks) > 0 {
+		err = writeSinks(ctx, db, sinks, opts.sinks)
+		if err != nil || opts.query == "" {
+			return err
 		}
-		defer db.Close()
+	}
 
-		err = createTables(ctx, db)
-		if err != nil {
-			return fmt.Errorf("failed to apply ddl: %w", err)
+	if opts.query != "" {
+		return runQuery(ctx, os.Stdout, db, opts.query, opts)
+	}
+
+	rl, err := newLineReader(opts.noTTY)
+	if err != nil {
+		return fmt.Errorf("failed to initialize prompt: %w", err)
+	}
+	defer rl.Close()
+
+	return prompt(ctx, db, rl, opts)
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// parseInterspersed parses the flags in args even when they come after positional
+// arguments, e.g. `tq diff a.db b.db --on test`, and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
 		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// addDatabaseFlags registers the flags subcommands use to locate their database
+func addDatabaseFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.pkgDir, "pkg", ".", "directory of the package to test")
+	fs.StringVar(&opts.dbFile, "dbfile", "testquery.db", "database file name for use with --open")
+	fs.BoolVar(&opts.open, "open", false, "open a database from a previous run")
+	fs.BoolVar(&opts.strict, "strict", false, "fail when any file could not be collected (see the collector_errors table)")
+	fs.StringVar(&opts.configFile, "config", defaultConfigFile, "config file declaring extra ddl and post-build sql")
+	fs.Var(&opts.extensions, "sqlite-extension", "load a SQLite extension into every connection (repeatable)")
+}
 
-		err = populateTables(ctx, db, pkgDir)
+// addQueryFlags registers the flags controlling how queries are linted, advised and rendered
+func addQueryFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.raw, "raw", false, "print results as undecorated tab-separated values")
+	fs.IntVar(&opts.maxCellBytes, "max-cell-bytes", 1024, "fold table cells larger than this many bytes")
+	fs.BoolVar(&opts.full, "full", false, "never fold large table cells")
+	fs.BoolVar(&opts.noLint, "no-lint", false, "do not warn about slow or suspicious queries")
+	fs.DurationVar(&opts.slowQuery, "slow-query", time.Second, "suggest indexes for queries slower than this, zero disables the advisor. The query_advice table is only created once there is a suggestion")
+	fs.BoolVar(&opts.autoIndex, "auto-index", false, "create the indexes suggested for slow queries instead of only recording them")
+}
+
+// loadDatabase opens the database from a previous run or builds a new one by running the package tests
+func loadDatabase(ctx context.Context, opts options) (*sql.DB, error) {
+	useExtensions(opts.extensions)
+
+	if opts.open {
+		db, err := sql.Open(sqliteDriver, opts.dbFile)
 		if err != nil {
-			return fmt.Errorf("failed to populate tables: %w", err)
+			return nil, fmt.Errorf("failed to open database: %w", err)
 		}
+		return db, nil
 	}
 
-	if persist {
-		defer persistDatabase(db, dbFile)
+	cfg, err := loadConfig(opts.configFile)
+	if err != nil {
+		return nil, err
 	}
 
-	if query != "" {
-		return executeQuery(db, query)
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate sqlite: %w", err)
 	}
-	return prompt(ctx, db, rl)
-}
 
-func executeQuery(db *sql.DB, query string) error {
-	rows, err := db.Query(query)
+	// every connection would get its own in-memory database
+	db.SetMaxOpenConns(1)
+
+	err = createTables(ctx, db)
+	if err == nil {
+		err = cfg.applyDDL(ctx, db)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to run query: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to apply ddl: %w", err)
 	}
-	defer rows.Close()
 
-	// Get column names
-	columns, err := rows.Columns()
+	err = populateTables(ctx, db, opts, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve column names: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to populate tables: %w", err)
 	}
 
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
+	if opts.strict {
+		err = checkCollectorErrors(ctx, db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 
-	var header = make(table.Row, len(columns))
-	for i := range columns {
-		header[i] = columns[i]
+	err = cfg.applyPostBuild(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply post-build sql: %w", err)
 	}
-	t.AppendHeader(header)
 
-	for rows.Next() {
-		var values = make(table.Row, len(columns))
-		var valuesPtr = make([]any, len(columns))
-		for i := range values {
-			valuesPtr[i] = &values[i]
-		}
+	return db, nil
+}
 
-		if err := rows.Scan(valuesPtr...); err != nil {
-			return fmt.Errorf("failed to read row: %w", err)
+// runQuery lints and executes a user query, recording its usage when enabled
+func runQuery(ctx context.Context, w io.Writer, db *sql.DB, query string, opts options) error {
+	if !opts.noLint {
+		warnings, err := lintQuery(ctx, db, query)
+		if err != nil {
+			return err
 		}
+		for _, warning := range warnings {
+			fmt.Fprintln(os.Stderr, "WARNING: ", warning)
+		}
+	}
 
-		t.AppendRow(values)
+	start := time.Now()
+	err := executeQuery(w, db, query, opts)
+	if err != nil {
+		return err
 	}
 
-	t.Render()
+	if elapsed := time.Since(start); opts.slowQuery > 0 && elapsed > opts.slowQuery {
+		// the query already succeeded, a failing advisor must not turn it into an error
+		advice, err := adviseIndexes(ctx, db, query, elapsed, opts.autoIndex)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "WARNING: ", "failed to advise indexes:", err)
+		}
+		for _, message := range advice {
+			fmt.Fprintln(os.Stderr, "ADVICE: ", message)
+		}
+	}
+
+	if opts.trackUsage {
+		return recordUsage(ctx, db, query)
+	}
 	return nil
 }
 
-func prompt(ctx context.Context, db *sql.DB, rl *readline.Instance) error {
+func executeQuery(w io.Writer, db *sql.DB, query string, opts options) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to run query: %w", err)
+	}
+	defer rows.Close()
+
+	// Get column names and declared types
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve column types: %w", err)
+	}
+
+	if opts.raw {
+		return renderRaw(w, rows, columns)
+	}
+
+	maxCellBytes := opts.maxCellBytes
+	if opts.full {
+		maxCellBytes = 0
+	}
+	return renderTable(w, rows, columns, maxCellBytes)
+}
+
+func prompt(ctx context.Context, db *sql.DB, rl lineReader, opts options) error {
 	var cmds []string
+	state := newShellState(opts.dbFile)
+	defer state.stopRecording()
 	for {
 		select {
 		case <-ctx.Done():
@@ -148,6 +351,16 @@ func prompt(ctx context.Context, db *sql.DB, rl *readline.Instance) error {
 			continue
 		}
 
+		// dot commands are only recognized at the start of a statement
+		if len(cmds) == 0 && strings.HasPrefix(line, ".") {
+			rl.SaveHistory(line)
+			err = state.dotCommand(ctx, db, line)
+			if err != nil {
+				fmt.Println("ERROR: ", err)
+			}
+			continue
+		}
+
 		cmds = append(cmds, line)
 		if !strings.HasSuffix(line, ";") {
 			rl.SetPrompt(">>> ")
@@ -159,9 +372,20 @@ func prompt(ctx context.Context, db *sql.DB, rl *readline.Instance) error {
 		rl.SetPrompt("> ")
 		rl.SaveHistory(cmd)
 
-		err = executeQuery(db, cmd)
+		query := state.expand(cmd)
+		var output strings.Builder
+		w := io.Writer(os.Stdout)
+		if state.transcript != nil {
+			w = io.MultiWriter(os.Stdout, &output)
+		}
+		err = runQuery(ctx, w, db, query, opts)
+		if rerr := state.record(query, output.String(), err); rerr != nil {
+			fmt.Println("ERROR: ", rerr)
+		}
 		if err != nil {
 			fmt.Println("ERROR: ", err)
+			continue
 		}
+		state.lastQuery = query
 	}
 }
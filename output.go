@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+const (
+	// timestampLayout is used to render TIMESTAMP and DATETIME values
+	timestampLayout = "2006-01-02 15:04:05.000Z07:00"
+
+	// floatPrecision is the number of decimals used to render floating point values
+	floatPrecision = 3
+
+	// blobPreviewBytes is the number of bytes of a blob shown in tables before it gets abbreviated
+	blobPreviewBytes = 16
+
+	// foldedCellLines is the maximum number of lines shown for a folded cell
+	foldedCellLines = 10
+)
+
+// rawEscaper escapes the characters that would break a tab-separated record
+var rawEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// renderTable prints the query results as a formatted table. Cells larger than maxCellBytes are
+// folded to their first lines, a value of zero or less disables folding.
+func renderTable(w io.Writer, rows *sql.Rows, columns []*sql.ColumnType, maxCellBytes int) error {
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+
+	var header = make(table.Row, len(columns))
+	var configs = make([]table.ColumnConfig, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name()
+
+		// values are kept as scanned and formatted by a transformer, so
+		// numeric columns are still detected and right aligned
+		declType := column.DatabaseTypeName()
+		configs[i] = table.ColumnConfig{
+			Number: i + 1,
+			Transformer: func(v any) string {
+				if v == nil {
+					return "<nil>"
+				}
+				return foldCell(formatValue(v, declType, false), maxCellBytes)
+			},
+		}
+	}
+	t.AppendHeader(header)
+	t.SetColumnConfigs(configs)
+
+	for rows.Next() {
+		var values = make(table.Row, len(columns))
+		var valuesPtr = make([]any, len(columns))
+		for i := range values {
+			valuesPtr[i] = &values[i]
+		}
+
+		if err := rows.Scan(valuesPtr...); err != nil {
+			return fmt.Errorf("failed to read row: %w", err)
+		}
+
+		t.AppendRow(values)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	t.Render()
+	return nil
+}
+
+// renderRaw prints the query results as tab-separated values, one row per line and without a header,
+// so the output can be piped into tools like awk, cut or sort
+func renderRaw(w io.Writer, rows *sql.Rows, columns []*sql.ColumnType) error {
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	values := make([]any, len(columns))
+	valuesPtr := make([]any, len(columns))
+	for i := range values {
+		valuesPtr[i] = &values[i]
+	}
+
+	fields := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(valuesPtr...); err != nil {
+			return fmt.Errorf("failed to read row: %w", err)
+		}
+
+		for i, v := range values {
+			fields[i] = rawEscaper.Replace(formatValue(v, columns[i].DatabaseTypeName(), true))
+		}
+
+		if _, err := fmt.Fprintln(bw, strings.Join(fields, "\t")); err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	return nil
+}
+
+// formatValue converts a scanned value to text according to its type and the declared type of its
+// column. NULL is the empty string. Blobs are hex encoded, abbreviated to a preview unless full is set.
+func formatValue(v any, declType string, full bool) string {
+	declType = strings.ToUpper(declType)
+
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(timestampLayout)
+	case float64:
+		return strconv.FormatFloat(v, 'f', floatPrecision, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		switch {
+		case isBoolType(declType):
+			return strconv.FormatBool(v != 0)
+		case isFloatType(declType):
+			return strconv.FormatFloat(float64(v), 'f', floatPrecision, 64)
+		}
+		return strconv.FormatInt(v, 10)
+	case []byte:
+		if full {
+			return hex.EncodeToString(v)
+		}
+		if len(v) <= blobPreviewBytes {
+			return "x'" + hex.EncodeToString(v) + "'"
+		}
+		return fmt.Sprintf("x'%s…' (%d bytes)", hex.EncodeToString(v[:blobPreviewBytes]), len(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// foldCell truncates cells larger than maxBytes to their first lines, telling how much was left out
+func foldCell(s string, maxBytes int) string {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s
+	}
+
+	folded := s[:maxBytes]
+	if i := strings.LastIndexByte(folded, '\n'); i > 0 {
+		folded = folded[:i]
+	}
+	if lines := strings.SplitN(folded, "\n", foldedCellLines+1); len(lines) > foldedCellLines {
+		folded = strings.Join(lines[:foldedCellLines], "\n")
+	}
+	folded = strings.ToValidUTF8(folded, "")
+
+	return fmt.Sprintf("%s\n… %s more, use --full to expand", folded, formatBytes(len(s)-len(folded)))
+}
+
+// formatBytes returns a human readable size
+func formatBytes(n int) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%dB", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1fKB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1024*1024))
+	}
+}
+
+func isBoolType(declType string) bool {
+	return strings.HasPrefix(declType, "BOOL")
+}
+
+func isFloatType(declType string) bool {
+	for _, t := range []string{"REAL", "FLOA", "DOUB", "NUMERIC", "DECIMAL"} {
+		if strings.Contains(declType, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Module represents a module of the main module or workspace, as reported by `go list -m -json`
+type Module struct {
+	Path string `json:"Path"`
+	Dir  string `json:"Dir"`
+}
+
+// PackageDir maps the import path used by coverage profiles to the directory used by all_code
+type PackageDir struct {
+	Package string `json:"package"`
+	Module  string `json:"module"`
+	Dir     string `json:"dir"`
+}
+
+// listModules returns the main modules seen from pkgDir, several of them in a go.work workspace
+func listModules(pkgDir string) ([]Module, error) {
+	cmd := exec.Command("go", "list", "-m", "-json")
+	cmd.Dir = pkgDir
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("go list -m failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	var modules []Module
+	dec := json.NewDecoder(strings.NewReader(string(output)))
+	for {
+		var m Module
+		err := dec.Decode(&m)
+		if errors.Is(err, io.EOF) {
+			return modules, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode go list output: %w", err)
+		}
+		if m.Dir != "" {
+			modules = append(modules, m)
+		}
+	}
+}
+
+// resolvePackageDir returns the import path of the package in dir, using the module with the longest
+// directory containing it so nested modules take precedence over their parents
+func resolvePackageDir(dir string, modules []Module) (PackageDir, bool) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return PackageDir{}, false
+	}
+
+	var best *Module
+	var bestRel string
+	for i, m := range modules {
+		rel, err := filepath.Rel(m.Dir, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if best == nil || len(m.Dir) > len(best.Dir) {
+			best, bestRel = &modules[i], rel
+		}
+	}
+	if best == nil {
+		return PackageDir{}, false
+	}
+
+	return PackageDir{
+		Package: path.Join(best.Path, filepath.ToSlash(bestRel)),
+		Module:  best.Path,
+		Dir:     dir,
+	}, true
+}
+
+// collectPackageDirs resolves the import path of every directory holding code
+func collectPackageDirs(pkgDir string, dirs []string, errs *collectorErrors) []PackageDir {
+	modules, err := listModules(pkgDir)
+	if err != nil {
+		errs.add("package_dirs", pkgDir, err)
+		return nil
+	}
+
+	var results []PackageDir
+	for _, dir := range dirs {
+		pd, ok := resolvePackageDir(dir, modules)
+		if !ok {
+			errs.add("package_dirs", dir, fmt.Errorf("directory is outside of the modules %v", modules))
+			continue
+		}
+		results = append(results, pd)
+	}
+	return results
+}
+
+// codeDirs returns the distinct directories of the all_code table
+func codeDirs(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT package FROM all_code ORDER BY package;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list code directories: %w", err)
+	}
+	defer rows.Close()
+
+	var dirs []string
+	for rows.Next() {
+		var dir string
+		if err := rows.Scan(&dir); err != nil {
+			return nil, fmt.Errorf("failed to read code directory: %w", err)
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, rows.Err()
+}
+
+func populatePackageDirs(ctx context.Context, db *sql.DB, pkgDir string, errs *collectorErrors) error {
+	dirs, err := codeDirs(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, pd := range collectPackageDirs(pkgDir, dirs, errs) {
+		insertSQL := `INSERT INTO package_dirs (package, module, dir) VALUES (?, ?, ?);`
+		_, err := db.ExecContext(ctx, insertSQL, pd.Package, pd.Module, pd.Dir)
+		if err != nil {
+			return fmt.Errorf("failed to insert package dirs: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// progressDelay is how long persisting runs before progress is reported
+	progressDelay = time.Second
+
+	// backupStepPages is the number of pages copied at a time with --no-vacuum
+	backupStepPages = 1024
+)
+
+// persistDatabase saves the database to dbFile. By default VACUUM INTO writes a compacted copy, with
+// noVacuum the pages are copied as they are with the online backup API, which is faster on huge
+// databases. The copy is written to a temporary file first and then replaces dbFile.
+func persistDatabase(ctx context.Context, db *sql.DB, dbFile string, noVacuum bool) error {
+	size, err := databaseSize(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	err = checkFreeSpace(filepath.Dir(dbFile), size)
+	if err != nil {
+		return err
+	}
+
+	tmpFile := dbFile + ".tmp"
+	os.Remove(tmpFile)
+
+	progress := newProgress(dbFile)
+	if noVacuum {
+		err = backupDatabase(ctx, db, tmpFile, progress)
+	} else {
+		err = vacuumInto(ctx, db, tmpFile, size, progress)
+	}
+	progress.done()
+	if err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to save database file: %w", err)
+	}
+
+	err = os.Rename(tmpFile, dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to save database file: %w", err)
+	}
+	return nil
+}
+
+// databaseSize returns the size of the database in bytes
+func databaseSize(ctx context.Context, db *sql.DB) (int64, error) {
+	var pages, pageSize int64
+	err := db.QueryRowContext(ctx, "SELECT page_count, page_size FROM pragma_page_count(), pragma_page_size();").Scan(&pages, &pageSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute database size: %w", err)
+	}
+	return pages * pageSize, nil
+}
+
+// checkFreeSpace fails early when the directory can't hold a database of the given size
+func checkFreeSpace(dir string, size int64) error {
+	free, ok, err := freeSpace(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check free disk space: %w", err)
+	}
+	if ok && free < uint64(size) {
+		return fmt.Errorf("not enough free space in %s to save the database: %s needed, %s available", dir, formatBytes(int(size)), formatBytes(int(free)))
+	}
+	return nil
+}
+
+// vacuumInto runs VACUUM INTO, reporting progress from the size of the file being written.
+// SQLite's progress handler would report the virtual machine steps, but go-sqlite3 v1.14.22 doesn't
+// expose sqlite3_progress_handler, so the size of the output file is polled instead. VACUUM builds
+// the copy in its own pages first, the file can stay small for a while before growing to the full
+// size: the percentage is a lower bound, and --no-vacuum reports exact page counts.
+func vacuumInto(ctx context.Context, db *sql.DB, fileName string, size int64, progress *progress) error {
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	defer func() {
+		// the reporter must be gone before progress.done reads its state
+		close(stop)
+		<-finished
+	}()
+
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(progressDelay)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if info, err := os.Stat(fileName); err == nil {
+					progress.report(info.Size(), size)
+				}
+			}
+		}
+	}()
+
+	_, err := db.ExecContext(ctx, "VACUUM INTO ?", fileName)
+	return err
+}
+
+// backupDatabase copies the database page by page into a new file with the SQLite online backup API
+func backupDatabase(ctx context.Context, db *sql.DB, fileName string, progress *progress) error {
+	dest, err := sql.Open(sqliteDriver, fileName)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			backup, err := destDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+
+			for {
+				done, err := backup.Step(backupStepPages)
+				if err != nil {
+					backup.Close()
+					return err
+				}
+				progress.report(int64(backup.PageCount()-backup.Remaining()), int64(backup.PageCount()))
+				if done {
+					break
+				}
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// progress prints the progress of persisting to stderr, once per second and only when persisting
+// takes longer than progressDelay
+type progress struct {
+	dbFile   string
+	start    time.Time
+	last     time.Time
+	reported bool
+}
+
+func newProgress(dbFile string) *progress {
+	return &progress{dbFile: dbFile, start: time.Now()}
+}
+
+func (p *progress) report(current, total int64) {
+	now := time.Now()
+	if now.Sub(p.start) < progressDelay || now.Sub(p.last) < time.Second || total <= 0 {
+		return
+	}
+	p.last = now
+	p.reported = true
+
+	percent := min(current*100/total, 100)
+	fmt.Fprintf(os.Stderr, "\rsaving %s: %d%%", p.dbFile, percent)
+}
+
+func (p *progress) done() {
+	if p.reported {
+		fmt.Fprintf(os.Stderr, "\rsaving %s: done in %s\n", p.dbFile, time.Since(p.start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// queryResult holds the rows of a query formatted as text, so results from different databases can be compared
+type queryResult struct {
+	columns []string
+	rows    [][]string
+}
+
+// diffRow is a row found in only one of the compared results, marked with - or +
+type diffRow struct {
+	marker string
+	values []string
+}
+
+// diffQuery runs the query against the session database and another database file, printing the rows
+// missing from the session as - and the rows new in the session as +. Changed rows show up as a -/+ pair.
+func diffQuery(ctx context.Context, w io.Writer, db *sql.DB, dbFile, query string) error {
+	if _, err := os.Stat(dbFile); err != nil {
+		return err
+	}
+
+	other, err := sql.Open(sqliteDriver, dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer other.Close()
+
+	before, err := collectQueryResult(ctx, other, query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", dbFile, err)
+	}
+
+	after, err := collectQueryResult(ctx, db, query)
+	if err != nil {
+		return err
+	}
+
+	if strings.Join(before.columns, "\x00") != strings.Join(after.columns, "\x00") {
+		return fmt.Errorf("query returns different columns in %s: %s", dbFile, strings.Join(before.columns, ", "))
+	}
+
+	diff := diffRows(before.rows, after.rows)
+	if len(diff) == 0 {
+		fmt.Fprintf(w, "no differences with %s (%d rows)\n", dbFile, len(after.rows))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+
+	header := table.Row{""}
+	for _, column := range after.columns {
+		header = append(header, column)
+	}
+	t.AppendHeader(header)
+
+	for _, d := range diff {
+		row := table.Row{d.marker}
+		for _, v := range d.values {
+			row = append(row, v)
+		}
+		t.AppendRow(row)
+	}
+	t.Render()
+
+	return nil
+}
+
+func collectQueryResult(ctx context.Context, db *sql.DB, query string) (queryResult, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return queryResult{}, fmt.Errorf("failed to run query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return queryResult{}, fmt.Errorf("failed to retrieve column types: %w", err)
+	}
+
+	var result queryResult
+	for _, column := range columns {
+		result.columns = append(result.columns, column.Name())
+	}
+
+	values := make([]any, len(columns))
+	valuesPtr := make([]any, len(columns))
+	for i := range values {
+		valuesPtr[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(valuesPtr...); err != nil {
+			return queryResult{}, fmt.Errorf("failed to read row: %w", err)
+		}
+
+		row := make([]string, len(columns))
+		for i, v := range values {
+			if v == nil {
+				row[i] = "<nil>"
+				continue
+			}
+			row[i] = formatValue(v, columns[i].DatabaseTypeName(), false)
+		}
+		result.rows = append(result.rows, row)
+	}
+
+	return result, rows.Err()
+}
+
+// diffRows compares two results as multisets of rows. The differences are sorted by their
+// values so that a changed row is shown as its removed version right before the added one.
+func diffRows(before, after [][]string) []diffRow {
+	remaining := make(map[string]int)
+	for _, row := range before {
+		remaining[strings.Join(row, "\x00")]++
+	}
+
+	var diff []diffRow
+	for _, row := range after {
+		key := strings.Join(row, "\x00")
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		diff = append(diff, diffRow{marker: "+", values: row})
+	}
+
+	for _, row := range before {
+		key := strings.Join(row, "\x00")
+		if remaining[key] > 0 {
+			remaining[key]--
+			diff = append(diff, diffRow{marker: "-", values: row})
+		}
+	}
+
+	sort.SliceStable(diff, func(i, j int) bool {
+		a, b := strings.Join(diff[i].values, "\x00"), strings.Join(diff[j].values, "\x00")
+		if a != b {
+			return a < b
+		}
+		return diff[i].marker == "-" && diff[j].marker == "+"
+	})
+	return diff
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func reportCmd(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "email" {
+		return reportEmailCmd(ctx, args[1:])
+	}
+	if len(args) > 0 && args[0] == "function-trend" {
+		return reportFunctionTrendCmd(ctx, args[1:])
+	}
+
+	var opts options
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	goldenUpdate := flags.String("golden-update", "", "write the output of each report to a golden file in this directory")
+	goldenCheck := flags.String("golden-check", "", "compare the output of each report with the golden files in this directory and fail on drift")
+	flags.IntVar(&opts.maxCellBytes, "max-cell-bytes", 1024, "fold table cells larger than this many bytes")
+	flags.BoolVar(&opts.full, "full", false, "never fold large table cells")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of report: tq report [flags] report.sql... | tq report email [flags] | tq report function-trend [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 || (*goldenUpdate != "" && *goldenCheck != "") {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var drifted []string
+	for _, reportFile := range flags.Args() {
+		output, err := renderReport(db, reportFile, opts)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case *goldenUpdate != "":
+			fileName := goldenFile(*goldenUpdate, reportFile)
+			err = os.MkdirAll(filepath.Dir(fileName), 0755)
+			if err != nil {
+				return fmt.Errorf("failed to create golden directory: %w", err)
+			}
+
+			err = os.WriteFile(fileName, output, 0644)
+			if err != nil {
+				return fmt.Errorf("failed to write golden file: %w", err)
+			}
+		case *goldenCheck != "":
+			ok, err := checkGolden(os.Stdout, goldenFile(*goldenCheck, reportFile), output)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				drifted = append(drifted, reportFile)
+			}
+		default:
+			os.Stdout.Write(output)
+		}
+	}
+
+	excluded, err := countExcludedPackages(ctx, db)
+	if err != nil {
+		return err
+	}
+	if excluded > 0 {
+		fmt.Fprintf(os.Stderr, "%d package(s) intentionally excluded, see the excluded_packages table\n", excluded)
+	}
+
+	if len(drifted) > 0 {
+		return fmt.Errorf("reports drifted from golden files: %s", strings.Join(drifted, ", "))
+	}
+	return nil
+}
+
+// renderReport executes every statement of a report file, rendering each result preceded by its statement
+func renderReport(db *sql.DB, reportFile string, opts options) ([]byte, error) {
+	data, err := os.ReadFile(reportFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+
+	var buf bytes.Buffer
+	for i, stmt := range splitStatements(string(data)) {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "-- %s\n", abbreviate(stripLineComments(stmt), 120))
+
+		err := executeQuery(&buf, db, stmt, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: statement %d: %w", reportFile, i+1, err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// goldenFile returns the golden file of a report, e.g. golden/reports/coverage.golden for reports/coverage.sql.
+// The file is keyed by the path of the report relative to the working directory, so reports sharing a
+// name in different directories don't overwrite each other. Reports outside of it keep their absolute path.
+func goldenFile(dir, reportFile string) string {
+	name := filepath.Clean(reportFile)
+	if abs, err := filepath.Abs(reportFile); err == nil {
+		name = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && filepath.IsLocal(rel) {
+				name = rel
+			}
+		}
+	}
+	return filepath.Join(dir, strings.TrimSuffix(name, filepath.Ext(name))+".golden")
+}
+
+// checkGolden compares the report output with its golden file, printing a diff when they differ
+func checkGolden(w io.Writer, fileName string, output []byte) (bool, error) {
+	golden, err := os.ReadFile(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(w, "missing golden file %s\n", fileName)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read golden file: %w", err)
+	}
+
+	if bytes.Equal(golden, output) {
+		return true, nil
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ actual output\n", fileName)
+	for _, line := range lineDiff(splitLines(string(golden)), splitLines(string(output))) {
+		fmt.Fprintln(w, line)
+	}
+	return false, nil
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineDiff returns the lines of a and b prefixed with "-" when only in a, "+" when only in b
+// and " " when in both, based on their longest common subsequence
+func lineDiff(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var result []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			result = append(result, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			result = append(result, "-"+a[i])
+			i++
+		default:
+			result = append(result, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		result = append(result, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		result = append(result, "+"+b[j])
+	}
+
+	return result
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	_ "embed"
+)
+
+//go:embed templates/report_email.html
+var emailTemplate string
+
+// emailStyles holds the CSS of each element class of the email template. Most email clients drop
+// <style> elements, so with --inline-css the rules are set in style attributes instead.
+var emailStyles = map[string]string{
+	"body":     "font-family: sans-serif; color: #222;",
+	"h1":       "font-size: 20px;",
+	"h2":       "font-size: 16px; margin-top: 24px;",
+	"summary":  "font-size: 14px;",
+	"empty":    "color: #666;",
+	"table":    "border-collapse: collapse; font-size: 13px;",
+	"th":       "border: 1px solid #ccc; padding: 4px 8px; background: #f3f3f3; text-align: left;",
+	"td":       "border: 1px solid #ccc; padding: 4px 8px;",
+	"number":   "border: 1px solid #ccc; padding: 4px 8px; text-align: right;",
+	"increase": "border: 1px solid #ccc; padding: 4px 8px; text-align: right; color: #1a7f37;",
+	"decrease": "border: 1px solid #ccc; padding: 4px 8px; text-align: right; color: #cf222e;",
+}
+
+// EmailReport holds the data rendered by the email template
+type EmailReport struct {
+	RunSummary
+	InlineCSS      bool
+	Failures       []EmailFailure
+	CoverageDeltas []CoverageDelta
+	Slowest        []SlowTest
+}
+
+// EmailFailure represents a failed test and its first logged message
+type EmailFailure struct {
+	Package string
+	Test    string
+	Message string
+}
+
+// CoverageDelta represents the coverage of a package compared to a previous run, Before is nil
+// for new packages or when no previous run is given
+type CoverageDelta struct {
+	Package string
+	Before  *float64
+	After   float64
+	Delta   *float64
+}
+
+// SlowTest represents a test and its duration in seconds
+type SlowTest struct {
+	Package string
+	Test    string
+	Elapsed float64
+}
+
+func reportEmailCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("report email", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	output := flags.String("o", "", "file the HTML report is written to (defaults to stdout)")
+	inlineCSS := flags.Bool("inline-css", false, "set the styles in style attributes, for email clients dropping <style> elements")
+	against := flags.String("against", "", "database of a previous run the coverage is compared with")
+	slowest := flags.Int("slowest", 10, "number of slowest tests listed")
+	flags.Parse(args)
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := collectEmailReport(ctx, db, *against, *slowest)
+	if err != nil {
+		return err
+	}
+	report.Package = opts.pkgDir
+	report.InlineCSS = *inlineCSS
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create report: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return renderEmailReport(w, report)
+}
+
+// collectEmailReport gathers the failures, the coverage of each package compared with the previous
+// run, if any, and the slowest tests
+func collectEmailReport(ctx context.Context, db *sql.DB, against string, slowest int) (EmailReport, error) {
+	summary, err := summarize(ctx, db)
+	if err != nil {
+		return EmailReport{}, err
+	}
+	report := EmailReport{RunSummary: summary}
+
+	rows, err := db.QueryContext(ctx, "SELECT package, test, ifnull(message, '') FROM test_failures ORDER BY package, test;")
+	if err != nil {
+		return EmailReport{}, fmt.Errorf("failed to list failures: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f EmailFailure
+		if err := rows.Scan(&f.Package, &f.Test, &f.Message); err != nil {
+			return EmailReport{}, fmt.Errorf("failed to read failure: %w", err)
+		}
+		report.Failures = append(report.Failures, f)
+	}
+	if err := rows.Err(); err != nil {
+		return EmailReport{}, err
+	}
+
+	report.CoverageDeltas, err = coverageDeltas(ctx, db, against)
+	if err != nil {
+		return EmailReport{}, err
+	}
+
+	report.Slowest, err = slowestTests(ctx, db, slowest)
+	if err != nil {
+		return EmailReport{}, err
+	}
+
+	return report, nil
+}
+
+// coverageDeltas compares the coverage of each package with the database of a previous run
+func coverageDeltas(ctx context.Context, db *sql.DB, against string) ([]CoverageDelta, error) {
+	current, err := packageCoverage(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous map[string]float64
+	if against != "" {
+		if _, err := os.Stat(against); err != nil {
+			return nil, err
+		}
+
+		old, err := sql.Open(sqliteDriver, against)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		defer old.Close()
+
+		previous, err = packageCoverage(ctx, old)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var deltas []CoverageDelta
+	for pkg, after := range current {
+		delta := CoverageDelta{Package: pkg, After: after}
+		if before, ok := previous[pkg]; ok {
+			diff := after - before
+			delta.Before, delta.Delta = &before, &diff
+		}
+		deltas = append(deltas, delta)
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Package < deltas[j].Package })
+
+	return deltas, nil
+}
+
+// slowestTests returns the n tests that took the longest
+func slowestTests(ctx context.Context, db *sql.DB, n int) ([]SlowTest, error) {
+	rows, err := db.QueryContext(ctx, "SELECT package, test, elapsed FROM all_tests WHERE elapsed IS NOT NULL ORDER BY elapsed DESC, package, test LIMIT ?;", n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list slowest tests: %w", err)
+	}
+	defer rows.Close()
+
+	var tests []SlowTest
+	for rows.Next() {
+		var t SlowTest
+		if err := rows.Scan(&t.Package, &t.Test, &t.Elapsed); err != nil {
+			return nil, fmt.Errorf("failed to read test duration: %w", err)
+		}
+		tests = append(tests, t)
+	}
+	return tests, rows.Err()
+}
+
+// renderEmailReport renders the report as a self-contained HTML document
+func renderEmailReport(w io.Writer, report EmailReport) error {
+	style := func(class string) template.HTMLAttr {
+		if report.InlineCSS {
+			return template.HTMLAttr(fmt.Sprintf("style=%q", emailStyles[class]))
+		}
+		return template.HTMLAttr(fmt.Sprintf("class=%q", class))
+	}
+
+	funcs := template.FuncMap{
+		"style": style,
+		"styleSheet": func() template.CSS {
+			classes := make([]string, 0, len(emailStyles))
+			for class := range emailStyles {
+				classes = append(classes, class)
+			}
+			sort.Strings(classes)
+
+			var b strings.Builder
+			for _, class := range classes {
+				fmt.Fprintf(&b, ".%s { %s }\n", class, emailStyles[class])
+			}
+			return template.CSS(strings.TrimSuffix(b.String(), "\n"))
+		},
+		"deltaStyle": func(delta *float64) template.HTMLAttr {
+			switch {
+			case delta != nil && *delta > 0:
+				return style("increase")
+			case delta != nil && *delta < 0:
+				return style("decrease")
+			}
+			return style("number")
+		},
+		"percent": func(v *float64) string {
+			if v == nil {
+				return "-"
+			}
+			return fmt.Sprintf("%.1f%%", *v)
+		},
+		"delta": func(v *float64) string {
+			if v == nil {
+				return "-"
+			}
+			return fmt.Sprintf("%+.1f", *v)
+		},
+	}
+
+	tmpl, err := template.New("email").Funcs(funcs).Parse(emailTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse email template: %w", err)
+	}
+
+	err = tmpl.Execute(w, report)
+	if err != nil {
+		return fmt.Errorf("failed to render email report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// sparkBars are the levels of a sparkline, from the lowest to the highest value
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// FunctionTrend is the coverage of a function and the duration of the tests covering it in one run
+type FunctionTrend struct {
+	Run               string  `json:"run"`
+	Package           string  `json:"package"`
+	Function          string  `json:"function"`
+	Statements        int     `json:"statements"`
+	CoveredStatements int     `json:"covered_statements"`
+	Coverage          float64 `json:"coverage"`
+	Tests             int     `json:"tests"`
+	TestDuration      float64 `json:"test_duration"`
+}
+
+// functionTrendQuery aggregates the coverage of a function per package, with the number and total
+// duration of the top-level tests covering it
+const functionTrendQuery = `
+SELECT c.package, c.function_name, sum(c.stmt_num), sum(CASE WHEN c.count > 0 THEN c.stmt_num ELSE 0 END),
+       (SELECT count(*) FROM all_tests t
+         WHERE t.package = c.package AND t.test IN (SELECT test_name FROM test_coverage tc
+                WHERE tc.package = c.package AND tc.function_name = c.function_name AND tc.count > 0)),
+       (SELECT ifnull(sum(t.elapsed), 0) FROM all_tests t
+         WHERE t.package = c.package AND t.test IN (SELECT test_name FROM test_coverage tc
+                WHERE tc.package = c.package AND tc.function_name = c.function_name AND tc.count > 0))
+  FROM all_coverage c
+ WHERE c.function_name = ?
+ GROUP BY c.package, c.function_name
+ ORDER BY c.package;`
+
+func reportFunctionTrendCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("report function-trend", flag.ExitOnError)
+	function := flags.String("function", "", "name of the function")
+	jsonOutput := flags.Bool("json", false, "print the trend as JSON, for dashboards")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of report function-trend: tq report function-trend [flags] --function Name run1.db [run2.db...]")
+		flags.PrintDefaults()
+	}
+	dbFiles := parseInterspersed(flags, args)
+
+	if *function == "" || len(dbFiles) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// an empty JSON array rather than null when the function is never found
+	trends := []FunctionTrend{}
+	for i, name := range uniqueSuffixes(dbFiles) {
+		runTrends, err := collectFunctionTrend(ctx, dbFiles[i], *function)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", dbFiles[i], err)
+		}
+		for _, trend := range runTrends {
+			trend.Run = name
+			trends = append(trends, trend)
+		}
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(trends)
+	}
+
+	if len(trends) == 0 {
+		fmt.Printf("function %s not found in any run\n", *function)
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"run", "package", "function", "statements", "covered", "coverage", "tests", "test duration"})
+	for _, trend := range trends {
+		t.AppendRow(table.Row{trend.Run, trend.Package, trend.Function, trend.Statements, trend.CoveredStatements, fmt.Sprintf("%.2f%%", trend.Coverage), trend.Tests, fmt.Sprintf("%.2fs", trend.TestDuration)})
+	}
+	t.Render()
+
+	// one sparkline per package, in the order of the runs
+	var packages []string
+	coverage := make(map[string][]float64)
+	durations := make(map[string][]float64)
+	for _, trend := range trends {
+		if _, ok := coverage[trend.Package]; !ok {
+			packages = append(packages, trend.Package)
+		}
+		coverage[trend.Package] = append(coverage[trend.Package], trend.Coverage)
+		durations[trend.Package] = append(durations[trend.Package], trend.TestDuration)
+	}
+	fmt.Println()
+	for _, pkg := range packages {
+		fmt.Printf("%s.%s  coverage %s  test duration %s\n", pkg, *function, sparkline(coverage[pkg]), sparkline(durations[pkg]))
+	}
+
+	return nil
+}
+
+// collectFunctionTrend reads the coverage of a function from a database file
+func collectFunctionTrend(ctx context.Context, dbFile, function string) ([]FunctionTrend, error) {
+	if _, err := os.Stat(dbFile); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(sqliteDriver, dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, functionTrendQuery, function)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query function coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var trends []FunctionTrend
+	for rows.Next() {
+		var trend FunctionTrend
+		err := rows.Scan(&trend.Package, &trend.Function, &trend.Statements, &trend.CoveredStatements, &trend.Tests, &trend.TestDuration)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read function coverage: %w", err)
+		}
+		if trend.Statements > 0 {
+			trend.Coverage = float64(trend.CoveredStatements) * 100 / float64(trend.Statements)
+		}
+		trends = append(trends, trend)
+	}
+
+	return trends, rows.Err()
+}
+
+// sparkline draws the values scaled between their minimum and maximum
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+
+	var sb strings.Builder
+	for _, v := range values {
+		level := len(sparkBars) - 1
+		if hi > lo {
+			level = int((v - lo) / (hi - lo) * float64(len(sparkBars)-1))
+		}
+		sb.WriteRune(sparkBars[level])
+	}
+	return sb.String()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func rerunCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rerun", flag.ExitOnError)
+	dbFile := fs.String("dbfile", "testquery.db", "database file holding the run to replay")
+	runID := fs.String("run", "", "id of the run to replay, as recorded in run_metadata (default the latest run)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage of rerun: tq rerun [--run id] [flags] [-- extra go test flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	db, err := sql.Open(sqliteDriver, *dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	metadata, err := loadRunMetadata(ctx, db, *runID)
+	if err != nil {
+		return err
+	}
+
+	pkgDir, ok := metadata["package"]
+	switch {
+	case !ok && *runID != "":
+		return fmt.Errorf("database %s has no run %s", *dbFile, *runID)
+	case !ok:
+		return fmt.Errorf("database %s has no run metadata to replay", *dbFile)
+	}
+
+	testArgs := append(replayArgs(pkgDir, metadata), fs.Args()...)
+
+	cmd := exec.CommandContext(ctx, "go", testArgs...)
+	cmd.Env = append(os.Environ(), "GOMAXPROCS="+metadata["gomaxprocs"])
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	fmt.Fprintf(os.Stderr, "run %s: GOMAXPROCS=%s go %s\n", metadata["run_id"], metadata["gomaxprocs"], strings.Join(testArgs, " "))
+	return cmd.Run()
+}
+
+// replayArgs returns the go test arguments replaying a run with the settings recorded in its metadata
+func replayArgs(pkgDir string, metadata map[string]string) []string {
+	return []string{"test", pkgDir, "-count=1", "-v", "-shuffle=" + metadata["shuffle"], "-parallel=" + metadata["parallel"]}
+}
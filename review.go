@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkHeaderRegexp matches unified diff hunk headers like "@@ -7,6 +7,8 @@ func divide"
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// FileDiff represents the changes made to a single file
+type FileDiff struct {
+	Path    string
+	Deleted bool
+	Hunks   []DiffHunk
+}
+
+// DiffHunk represents a hunk of a unified diff, with line numbers relative to the new version of the file
+type DiffHunk struct {
+	Header    string
+	StartLine int
+	EndLine   int
+	Lines     []DiffLine
+}
+
+// DiffLine is a single line of a hunk. LineNumber is zero for removed lines.
+type DiffLine struct {
+	Kind       byte
+	LineNumber int
+	Content    string
+}
+
+// lineCoverage is the coverage status of a single source line
+type lineCoverage int
+
+const (
+	notExecutable lineCoverage = iota
+	uncovered
+	covered
+)
+
+func reviewCmd(ctx context.Context, args []string) error {
+	var opts options
+	fs := flag.NewFlagSet("review", flag.ExitOnError)
+	addDatabaseFlags(fs, &opts)
+	base := fs.String("base", "main", "git revision to compare the working tree against")
+	outDir := fs.String("o", "review", "directory where the review files are written")
+	fs.Parse(args)
+
+	diffs, err := collectDiffs(*base, opts.pkgDir)
+	if err != nil {
+		return fmt.Errorf("failed to collect diff: %w", err)
+	}
+	if len(diffs) == 0 {
+		fmt.Println("no changes found against", *base)
+		return nil
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = os.MkdirAll(*outDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	for _, diff := range diffs {
+		packet, err := reviewPacket(ctx, db, *base, diff)
+		if err != nil {
+			return fmt.Errorf("failed to annotate %s: %w", diff.Path, err)
+		}
+
+		fileName := filepath.Join(*outDir, strings.ReplaceAll(diff.Path, "/", "_")+".md")
+		err = os.WriteFile(fileName, packet, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write review file: %w", err)
+		}
+		fmt.Println(fileName)
+	}
+
+	return nil
+}
+
+// collectDiffs runs `git diff` against base and splits the output by file
+func collectDiffs(base, pkgDir string) ([]FileDiff, error) {
+	cmd := exec.Command("git", "diff", "--no-color", "--relative", base, "--", pkgDir)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseDiff(output)
+}
+
+func parseDiff(output []byte) ([]FileDiff, error) {
+	var diffs []FileDiff
+	var file *FileDiff
+	var hunk *DiffHunk
+	var lineNumber int
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			diffs = append(diffs, FileDiff{})
+			file = &diffs[len(diffs)-1]
+			hunk = nil
+		case file == nil:
+			continue
+		case hunk == nil && strings.HasPrefix(line, "+++ "):
+			// deleted files keep the path of the old side
+			path := strings.TrimPrefix(line, "+++ ")
+			if path == "/dev/null" {
+				file.Deleted = true
+				continue
+			}
+			file.Path = strings.TrimPrefix(path, "b/")
+		case hunk == nil && strings.HasPrefix(line, "--- "):
+			if file.Path == "" {
+				file.Path = strings.TrimPrefix(strings.TrimPrefix(line, "--- "), "a/")
+			}
+		case strings.HasPrefix(line, "@@ "):
+			m := hunkHeaderRegexp.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("malformed hunk header: %q", line)
+			}
+			start, _ := strconv.Atoi(m[1])
+			length := 1
+			if m[2] != "" {
+				length, _ = strconv.Atoi(m[2])
+			}
+			file.Hunks = append(file.Hunks, DiffHunk{Header: line, StartLine: start, EndLine: start + length - 1})
+			hunk = &file.Hunks[len(file.Hunks)-1]
+			lineNumber = start
+		case hunk != nil && len(line) > 0 && (line[0] == ' ' || line[0] == '+'):
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: line[0], LineNumber: lineNumber, Content: line[1:]})
+			lineNumber++
+		case hunk != nil && len(line) > 0 && line[0] == '-':
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: '-', Content: line[1:]})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return diffs, nil
+}
+
+// reviewPacket renders the markdown review file for a single changed file
+func reviewPacket(ctx context.Context, db *sql.DB, base string, diff FileDiff) ([]byte, error) {
+	dir, fileName := filepath.Dir(diff.Path), filepath.Base(diff.Path)
+	coverage, err := fileLineCoverage(ctx, db, dir, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n\n", diff.Path)
+	fmt.Fprintf(&buf, "Changes compared against `%s`. Lines marked with ✓ are covered by tests, lines marked with ✗ are not.\n", base)
+
+	if diff.Deleted {
+		fmt.Fprintf(&buf, "\nFile deleted.\n")
+		return buf.Bytes(), nil
+	}
+	if len(diff.Hunks) == 0 {
+		fmt.Fprintf(&buf, "\nNo line changes to review.\n")
+		return buf.Bytes(), nil
+	}
+
+	var added, addedCovered, addedUncovered int
+	for _, hunk := range diff.Hunks {
+		for _, line := range hunk.Lines {
+			if line.Kind != '+' {
+				continue
+			}
+			added++
+			switch coverage[line.LineNumber] {
+			case covered:
+				addedCovered++
+			case uncovered:
+				addedUncovered++
+			}
+		}
+	}
+	fmt.Fprintf(&buf, "\n%d lines added: %d covered, %d uncovered, %d without statements.\n", added, addedCovered, addedUncovered, added-addedCovered-addedUncovered)
+
+	for i, hunk := range diff.Hunks {
+		tests, err := hunkTests(ctx, db, dir, fileName, hunk.StartLine, hunk.EndLine)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&buf, "\n## Hunk %d (lines %d-%d)\n\n", i+1, hunk.StartLine, hunk.EndLine)
+		if len(tests) == 0 {
+			fmt.Fprintf(&buf, "No tests exercise this hunk.\n\n")
+		} else {
+			fmt.Fprintf(&buf, "Tests exercising this hunk: `%s`\n\n", strings.Join(tests, "`, `"))
+		}
+
+		fmt.Fprintf(&buf, "```diff\n%s\n", hunk.Header)
+		for _, line := range hunk.Lines {
+			marker := " "
+			if line.Kind != '-' {
+				switch coverage[line.LineNumber] {
+				case covered:
+					marker = "✓"
+				case uncovered:
+					marker = "✗"
+				}
+			}
+			fmt.Fprintf(&buf, "%c%s %s\n", line.Kind, marker, line.Content)
+		}
+		fmt.Fprintf(&buf, "```\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// coveragePackageFilter restricts coverage rows to the package of a directory through package_dirs,
+// so same-named files of different packages are kept apart. Without a mapping any package matches.
+const coveragePackageFilter = `package = ifnull((SELECT package FROM package_dirs WHERE dir = ?), package)`
+
+// fileLineCoverage returns the coverage status of every executable line of a file
+func fileLineCoverage(ctx context.Context, db *sql.DB, dir, fileName string) (map[int]lineCoverage, error) {
+	rows, err := db.QueryContext(ctx, "SELECT start_line, end_line, count FROM all_coverage WHERE file = ? AND "+coveragePackageFilter+";", fileName, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query coverage: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[int]lineCoverage)
+	for rows.Next() {
+		var start, end, count int
+		if err := rows.Scan(&start, &end, &count); err != nil {
+			return nil, fmt.Errorf("failed to read coverage: %w", err)
+		}
+
+		status := uncovered
+		if count > 0 {
+			status = covered
+		}
+		for line := start; line <= end; line++ {
+			if status > result[line] {
+				result[line] = status
+			}
+		}
+	}
+
+	return result, rows.Err()
+}
+
+// hunkTests returns the names of the tests covering any block that overlaps the given line range
+func hunkTests(ctx context.Context, db *sql.DB, dir, fileName string, startLine, endLine int) ([]string, error) {
+	query := `SELECT DISTINCT test_name FROM test_coverage WHERE file = ? AND ` + coveragePackageFilter + ` AND count > 0 AND start_line <= ? AND end_line >= ? ORDER BY test_name;`
+	rows, err := db.QueryContext(ctx, query, fileName, dir, endLine, startLine)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query test coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var tests []string
+	for rows.Next() {
+		var test string
+		if err := rows.Scan(&test); err != nil {
+			return nil, fmt.Errorf("failed to read test name: %w", err)
+		}
+		tests = append(tests, test)
+	}
+
+	return tests, rows.Err()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+const deletionDiff = `diff --git a/old.go b/old.go
+deleted file mode 100644
+index 1234567..0000000
+--- a/old.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-package fixture
+-
+-func old() {}
+diff --git a/new.go b/new.go
+new file mode 100644
+index 0000000..1234567
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,2 @@
++package fixture
++func added() {}
+`
+
+func TestParseDiff(t *testing.T) {
+	diffs, err := parseDiff([]byte(deletionDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("parseDiff() returned %d files, want 2", len(diffs))
+	}
+
+	if diffs[0].Path != "old.go" || !diffs[0].Deleted {
+		t.Errorf("deleted file parsed as path=%q deleted=%v, want path=old.go deleted=true", diffs[0].Path, diffs[0].Deleted)
+	}
+	if diffs[1].Path != "new.go" || diffs[1].Deleted {
+		t.Errorf("new file parsed as path=%q deleted=%v, want path=new.go deleted=false", diffs[1].Path, diffs[1].Deleted)
+	}
+	if len(diffs[1].Hunks) != 1 || diffs[1].Hunks[0].StartLine != 1 || diffs[1].Hunks[0].EndLine != 2 {
+		t.Errorf("new file hunks = %+v, want a single hunk on lines 1-2", diffs[1].Hunks)
+	}
+}
+
+func TestFileLineCoverageSameFileName(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	statements := []string{
+		`INSERT INTO package_dirs (package, module, dir) VALUES ('ex/a', 'ex', 'a'), ('ex/b', 'ex', 'b');`,
+		`INSERT INTO all_coverage (package, file, start_line, start_col, end_line, end_col, stmt_num, count, function_name) VALUES ('ex/a', 'util.go', 3, 1, 5, 2, 1, 1, 'A');`,
+		`INSERT INTO all_coverage (package, file, start_line, start_col, end_line, end_col, stmt_num, count, function_name) VALUES ('ex/b', 'util.go', 3, 1, 5, 2, 1, 0, 'B');`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for dir, want := range map[string]lineCoverage{"a": covered, "b": uncovered} {
+		coverage, err := fileLineCoverage(ctx, db, dir, "util.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if coverage[4] != want {
+			t.Errorf("line 4 of %s/util.go has coverage %d, want %d", dir, coverage[4], want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// shuffleSeedRegexp matches the line go test prints when -shuffle is enabled
+	shuffleSeedRegexp = regexp.MustCompile(`^-test\.shuffle (-?\d+)`)
+
+	// testSeedRegexp matches random seeds printed by the tests themselves, like "seed: 42" or "using seed=42"
+	testSeedRegexp = regexp.MustCompile(`(?i)\bseed\b\s*[:=]?\s*(-?\d+)`)
+)
+
+// runIDLayout formats the start time of a collection into its run id
+const runIDLayout = "20060102-150405"
+
+// RunSettings holds the settings that influence the outcome of a test run
+type RunSettings struct {
+	// RunID identifies the run in run_metadata and for tq rerun --run
+	RunID string
+
+	Shuffle    string
+	Parallel   int
+	GOMAXPROCS int
+
+	// SetupCmd and TeardownCmd run once around the whole collection
+	SetupCmd      string
+	TeardownCmd   string
+	SetupDuration time.Duration
+
+	// TestCoverMode is the mode of the per-test coverage profiles, set once they are collected
+	TestCoverMode string
+
+	// HasTestMain tells whether the package runs its own global setup in TestMain
+	HasTestMain bool
+}
+
+func newRunSettings(opts options) RunSettings {
+	settings := RunSettings{
+		RunID:       time.Now().UTC().Format(runIDLayout),
+		Shuffle:     opts.shuffle,
+		Parallel:    opts.parallel,
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		SetupCmd:    opts.setupCmd,
+		TeardownCmd: opts.teardownCmd,
+	}
+
+	if settings.Shuffle == "" {
+		settings.Shuffle = "off"
+	}
+
+	// go test defaults -parallel to GOMAXPROCS
+	if settings.Parallel <= 0 {
+		settings.Parallel = settings.GOMAXPROCS
+	}
+
+	return settings
+}
+
+// testArgs returns the go test flags reproducing these settings
+func (s RunSettings) testArgs() []string {
+	return []string{"-shuffle=" + s.Shuffle, "-parallel=" + strconv.Itoa(s.Parallel)}
+}
+
+// testEnv returns the environment of go test. GOMAXPROCS is passed explicitly, so the recorded value
+// is the one the tests ran with rather than whatever the child would have computed on its own.
+func (s RunSettings) testEnv() []string {
+	return []string{"GOMAXPROCS=" + strconv.Itoa(s.GOMAXPROCS)}
+}
+
+// collectRunMetadata extracts the run settings and any seeds printed by go test or the tests
+func collectRunMetadata(pkgDir string, settings RunSettings, events []TestEvent) (map[string]string, error) {
+	absDir, err := filepath.Abs(pkgDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve package directory: %w", err)
+	}
+
+	metadata := map[string]string{
+		"package":       absDir,
+		"collected_at":  time.Now().Format(time.RFC3339),
+		"shuffle":       settings.Shuffle,
+		"parallel":      strconv.Itoa(settings.Parallel),
+		"gomaxprocs":    strconv.Itoa(settings.GOMAXPROCS),
+		"go_test_args":  strings.Join(settings.testArgs(), " "),
+		"has_test_main": strconv.FormatBool(settings.HasTestMain),
+	}
+
+	if settings.SetupCmd != "" {
+		metadata["setup_cmd"] = settings.SetupCmd
+		metadata["setup_duration"] = strconv.FormatFloat(settings.SetupDuration.Seconds(), 'f', 3, 64)
+	}
+	if settings.TeardownCmd != "" {
+		metadata["teardown_cmd"] = settings.TeardownCmd
+	}
+	if settings.TestCoverMode != "" {
+		metadata["test_covermode"] = settings.TestCoverMode
+	}
+
+	for _, event := range events {
+		if event.Action != "output" || event.Output == nil {
+			continue
+		}
+		line := strings.TrimSpace(*event.Output)
+
+		if m := shuffleSeedRegexp.FindStringSubmatch(line); m != nil {
+			metadata["shuffle"] = m[1]
+			continue
+		}
+
+		if event.Test == "" {
+			continue
+		}
+		if m := testSeedRegexp.FindStringSubmatch(line); m != nil {
+			metadata["seed."+event.Test] = m[1]
+		}
+	}
+
+	return metadata, nil
+}
+
+func populateRunMetadata(ctx context.Context, db *sql.DB, pkgDir string, settings RunSettings, events []TestEvent) error {
+	metadata, err := collectRunMetadata(pkgDir, settings, events)
+	if err != nil {
+		return fmt.Errorf("failed to collect run metadata: %w", err)
+	}
+
+	for key, value := range metadata {
+		insertSQL := `INSERT INTO run_metadata (run_id, key, value) VALUES (?, ?, ?);`
+		_, err := db.ExecContext(ctx, insertSQL, settings.RunID, key, value)
+		if err != nil {
+			return fmt.Errorf("failed to insert run metadata: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadRunMetadata reads the metadata of a run into a map, including its run_id. An empty runID
+// selects the latest run of the database. The map is empty when there is no such run.
+func loadRunMetadata(ctx context.Context, db *sql.DB, runID string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT run_id, key, value FROM run_metadata
+		WHERE run_id = ifnull(nullif(?, ''), (SELECT max(run_id) FROM run_metadata));`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query run metadata: %w", err)
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var id, key, value string
+		if err := rows.Scan(&id, &key, &value); err != nil {
+			return nil, fmt.Errorf("failed to read run metadata: %w", err)
+		}
+		metadata["run_id"] = id
+		metadata[key] = value
+	}
+
+	return metadata, rows.Err()
+}
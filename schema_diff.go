@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// schemaObject is a table or view with its columns and their declared types
+type schemaObject struct {
+	kind    string
+	columns map[string]string
+	order   []string
+}
+
+func schemaCmd(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "diff" {
+		return schemaDiffCmd(ctx, args[1:])
+	}
+
+	fmt.Fprintln(os.Stderr, "Usage of schema: tq schema diff --against old.db")
+	os.Exit(2)
+	return nil
+}
+
+func schemaDiffCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("schema diff", flag.ExitOnError)
+	against := flags.String("against", "", "database created by an older version of tq")
+	configFile := flags.String("config", defaultConfigFile, "config file whose extra ddl and post-build sql are left out of the diff")
+	flags.Parse(args)
+
+	if *against == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if _, err := os.Stat(*against); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	old, err := sql.Open(sqliteDriver, *against)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer old.Close()
+
+	current, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		return fmt.Errorf("failed to instantiate sqlite: %w", err)
+	}
+	defer current.Close()
+
+	// the tables created on demand are part of the schema too
+	for _, ddl := range []string{ddl, usageDDL, queryAdviceDDL} {
+		_, err = current.ExecContext(ctx, ddl)
+		if err != nil {
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+
+	before, err := loadSchema(ctx, old)
+	if err != nil {
+		return fmt.Errorf("failed to read schema of %s: %w", *against, err)
+	}
+
+	builtin, err := loadSchema(ctx, current)
+	if err != nil {
+		return err
+	}
+
+	// objects declared by the config are not part of the schema of tq, applying the config to the
+	// current schema too keeps its changes to the built-in tables from showing up as differences
+	err = cfg.applyDDL(ctx, current)
+	if err != nil {
+		return fmt.Errorf("failed to apply config ddl: %w", err)
+	}
+	err = cfg.applyPostBuild(ctx, current)
+	if err != nil {
+		return fmt.Errorf("failed to apply post-build sql: %w", err)
+	}
+
+	after, err := loadSchema(ctx, current)
+	if err != nil {
+		return err
+	}
+	for name := range after {
+		if builtin[name] == nil {
+			delete(before, name)
+			delete(after, name)
+		}
+	}
+
+	changes := diffSchemas(before, after)
+	if len(changes) == 0 {
+		fmt.Println("no schema changes since", *against)
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"object", "kind", "change", "detail"})
+	for _, change := range changes {
+		t.AppendRow(change)
+	}
+	t.Render()
+
+	return nil
+}
+
+// loadSchema reads the tables and views of a database with their columns
+func loadSchema(ctx context.Context, db *sql.DB) (map[string]*schemaObject, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, type FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%';")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	schema := make(map[string]*schemaObject)
+	for rows.Next() {
+		var name, kind string
+		if err := rows.Scan(&name, &kind); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read table name: %w", err)
+		}
+		schema[name] = &schemaObject{kind: kind, columns: make(map[string]string)}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for name, obj := range schema {
+		rows, err := db.QueryContext(ctx, "SELECT name, type FROM pragma_table_info(?);", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read columns of %s: %w", name, err)
+		}
+		for rows.Next() {
+			var column, declType string
+			if err := rows.Scan(&column, &declType); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to read columns of %s: %w", name, err)
+			}
+			obj.columns[column] = declType
+			obj.order = append(obj.order, column)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return schema, nil
+}
+
+// diffSchemas lists the objects and columns added, removed or changed between two schemas
+func diffSchemas(before, after map[string]*schemaObject) []table.Row {
+	names := make(map[string]bool)
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var changes []table.Row
+	for _, name := range sorted {
+		old, cur := before[name], after[name]
+		switch {
+		case old == nil:
+			changes = append(changes, table.Row{name, cur.kind, "added", strings.Join(cur.order, ", ")})
+		case cur == nil:
+			changes = append(changes, table.Row{name, old.kind, "removed", ""})
+		case old.kind != cur.kind:
+			changes = append(changes, table.Row{name, cur.kind, "changed", "was a " + old.kind})
+		default:
+			for _, column := range cur.order {
+				oldType, ok := old.columns[column]
+				switch {
+				case !ok:
+					changes = append(changes, table.Row{name, cur.kind, "column added", column + " " + cur.columns[column]})
+				case oldType != cur.columns[column]:
+					changes = append(changes, table.Row{name, cur.kind, "column changed", fmt.Sprintf("%s %s (was %s)", column, cur.columns[column], oldType)})
+				}
+			}
+			for _, column := range old.order {
+				if _, ok := cur.columns[column]; !ok {
+					changes = append(changes, table.Row{name, cur.kind, "column removed", column})
+				}
+			}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// TestRisk is the failure probability of a test estimated from previous runs
+type TestRisk struct {
+	Package     string
+	Test        string
+	Runs        int
+	Failures    int
+	Probability float64
+}
+
+func selectCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("select", flag.ExitOnError)
+	riskTop := flags.String("risk-top", "20%", "number of tests to select, or a percentage of all tests like 20%")
+	regexpOnly := flags.Bool("regexp-only", false, "only print the -run regexp, for use in scripts")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage of select: tq select [flags] run1.db [run2.db...]")
+		flags.PrintDefaults()
+	}
+	dbFiles := parseInterspersed(flags, args)
+
+	if len(dbFiles) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	risks, err := collectTestRisks(ctx, dbFiles)
+	if err != nil {
+		return err
+	}
+
+	n, err := parseRiskTop(*riskTop, len(risks))
+	if err != nil {
+		return err
+	}
+	if n < len(risks) {
+		risks = risks[:n]
+	}
+
+	tests := make([]string, len(risks))
+	for i, r := range risks {
+		tests[i] = r.Test
+	}
+	pattern := runRegexp(tests)
+	if *regexpOnly {
+		fmt.Println(pattern)
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"package", "test", "runs", "failures", "probability"})
+	for _, r := range risks {
+		t.AppendRow(table.Row{r.Package, r.Test, r.Runs, r.Failures, fmt.Sprintf("%.2f", r.Probability)})
+	}
+	t.Render()
+
+	fmt.Printf("\ngo test -run '%s'\n", pattern)
+	return nil
+}
+
+// collectTestRisks computes the failure rate of every test across the runs stored in the database
+// files, riskiest first. Ties are broken by the number of failures, so tests failing often in a long
+// history rank before tests that failed once in a single run.
+func collectTestRisks(ctx context.Context, dbFiles []string) ([]TestRisk, error) {
+	spec := matrixQueries["test"]
+
+	risks := make(map[string]*TestRisk)
+	for _, dbFile := range dbFiles {
+		rows, err := collectMatrixColumn(ctx, dbFile, len(spec.keys), spec.query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", dbFile, err)
+		}
+
+		for key, cell := range rows {
+			r, ok := risks[key]
+			if !ok {
+				pkg, test, _ := strings.Cut(key, "\x00")
+				r = &TestRisk{Package: pkg, Test: test}
+				risks[key] = r
+			}
+			r.Runs++
+			if cell.status == "fail" {
+				r.Failures++
+			}
+		}
+	}
+
+	result := make([]TestRisk, 0, len(risks))
+	for _, r := range risks {
+		r.Probability = float64(r.Failures) / float64(r.Runs)
+		result = append(result, *r)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Probability != b.Probability {
+			return a.Probability > b.Probability
+		}
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.Package+"\x00"+a.Test < b.Package+"\x00"+b.Test
+	})
+	return result, nil
+}
+
+// parseRiskTop converts a count or a percentage of total into a number of tests, at least one
+func parseRiskTop(value string, total int) (int, error) {
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("invalid value for --risk-top: %q", value)
+		}
+		return max(int(math.Ceil(float64(total)*p/100)), 1), nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid value for --risk-top: %q", value)
+	}
+	return n, nil
+}
+
+// runRegexp returns a -run regexp matching the given tests. Subtests are selected through
+// their top-level test, since -run matches each level of the name separately.
+func runRegexp(tests []string) string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, test := range tests {
+		name, _, _ := strings.Cut(test, "/")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, regexp.QuoteMeta(name))
+		}
+	}
+	return "^(" + strings.Join(names, "|") + ")$"
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// Shard is a group of tests meant to run on the same CI worker
+type Shard struct {
+	Tests    []string
+	Duration float64
+}
+
+// testDuration is the recorded duration of a top-level test
+type testDuration struct {
+	pkg     string
+	test    string
+	elapsed float64
+}
+
+// testNameRegexp matches the test names printed by `go test -list`, leaving out examples, benchmarks and fuzz tests
+var testNameRegexp = regexp.MustCompile(`^Test[^\s]*$`)
+
+// noTestsRegexp is the -run regexp of a shard without tests, no test has an empty name
+const noTestsRegexp = "^$"
+
+func shardPlanCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("shard-plan", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	shards := flags.Int("shards", 2, "number of shards")
+	shard := flags.Int("shard", 0, "only print the -run regexp of this shard, numbered from 1")
+	flags.Parse(args)
+
+	if *shards <= 0 || *shard < 0 || *shard > *shards {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	durations, err := collectTestDurations(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// tests added since the database was collected have no duration yet, they are planned
+	// with the average duration of the known tests
+	listed, err := listTests(opts.pkgDir)
+	if err != nil {
+		log.Println("failed to list the tests, only the tests of the database are planned:", err)
+	}
+	durations = addUnknownTests(durations, listed)
+
+	// CI matrices may have more nodes than there are tests, the extra shards run nothing
+	plan := planShards(durations, *shards)
+	if *shard > 0 {
+		if *shard > len(plan) {
+			fmt.Println(noTestsRegexp)
+			return nil
+		}
+		fmt.Println(runRegexp(plan[*shard-1].Tests))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"shard", "tests", "duration", "run"})
+	for i, s := range plan {
+		t.AppendRow(table.Row{i + 1, len(s.Tests), fmt.Sprintf("%.2fs", s.Duration), runRegexp(s.Tests)})
+	}
+	t.Render()
+
+	return nil
+}
+
+// collectTestDurations reads the durations of the top-level tests, whose elapsed time includes their subtests
+func collectTestDurations(ctx context.Context, db *sql.DB) ([]testDuration, error) {
+	rows, err := db.QueryContext(ctx, `SELECT package, test, sum(ifnull(elapsed, 0)) FROM all_tests WHERE test NOT LIKE '%/%' GROUP BY package, test;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query test durations: %w", err)
+	}
+	defer rows.Close()
+
+	var durations []testDuration
+	for rows.Next() {
+		var d testDuration
+		if err := rows.Scan(&d.pkg, &d.test, &d.elapsed); err != nil {
+			return nil, fmt.Errorf("failed to read test durations: %w", err)
+		}
+		durations = append(durations, d)
+	}
+
+	return durations, rows.Err()
+}
+
+// listTests lists the top-level tests currently declared in the package with `go test -list`
+func listTests(pkgDir string) ([]testDuration, error) {
+	output, err := exec.Command("go", "test", "-list", ".", "-json", pkgDir).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := parseTestOutput(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse test list: %w", err)
+	}
+
+	var tests []testDuration
+	for _, event := range events {
+		if event.Action != "output" || event.Output == nil {
+			continue
+		}
+		if name := strings.TrimSpace(*event.Output); testNameRegexp.MatchString(name) {
+			tests = append(tests, testDuration{pkg: event.Package, test: name})
+		}
+	}
+	return tests, nil
+}
+
+// addUnknownTests appends the listed tests missing from durations, with the average known duration
+func addUnknownTests(durations, listed []testDuration) []testDuration {
+	known := make(map[string]bool, len(durations))
+	var total float64
+	for _, d := range durations {
+		known[d.pkg+"\x00"+d.test] = true
+		total += d.elapsed
+	}
+
+	var average float64
+	if len(durations) > 0 {
+		average = total / float64(len(durations))
+	}
+
+	for _, d := range listed {
+		if !known[d.pkg+"\x00"+d.test] {
+			d.elapsed = average
+			durations = append(durations, d)
+		}
+	}
+	return durations
+}
+
+// planShards balances the tests across shards with the longest processing time first heuristic:
+// tests are assigned from the slowest to the fastest, each to the shard with the least work so far.
+// There are never more shards than tests, so every shard has at least one test.
+func planShards(durations []testDuration, n int) []Shard {
+	n = min(n, len(durations))
+	sort.Slice(durations, func(i, j int) bool {
+		if durations[i].elapsed != durations[j].elapsed {
+			return durations[i].elapsed > durations[j].elapsed
+		}
+		if durations[i].test != durations[j].test {
+			return durations[i].test < durations[j].test
+		}
+		return durations[i].pkg < durations[j].pkg
+	})
+
+	shards := make([]Shard, n)
+	for _, d := range durations {
+		lightest := 0
+		for i := range shards {
+			if shards[i].Duration < shards[lightest].Duration || (shards[i].Duration == shards[lightest].Duration && len(shards[i].Tests) < len(shards[lightest].Tests)) {
+				lightest = i
+			}
+		}
+		shards[lightest].Tests = append(shards[lightest].Tests, d.test)
+		shards[lightest].Duration += d.elapsed
+	}
+
+	return shards
+}
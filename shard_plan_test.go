@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanShards(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []testDuration
+		listed    []testDuration
+		shards    int
+		want      [][]string
+	}{
+		{
+			name:      "balanced",
+			durations: []testDuration{{"a", "TestA", 3}, {"a", "TestB", 2}, {"a", "TestC", 1}},
+			shards:    2,
+			want:      [][]string{{"TestA"}, {"TestB", "TestC"}},
+		},
+		{
+			name:      "more shards than tests",
+			durations: []testDuration{{"a", "TestA", 3}},
+			shards:    4,
+			want:      [][]string{{"TestA"}},
+		},
+		{
+			name:      "same name in two packages",
+			durations: []testDuration{{"a", "TestA", 2}, {"b", "TestA", 2}},
+			shards:    2,
+			want:      [][]string{{"TestA"}, {"TestA"}},
+		},
+		{
+			name:      "unknown test gets the average duration",
+			durations: []testDuration{{"a", "TestA", 4}, {"a", "TestB", 2}},
+			listed:    []testDuration{{"a", "TestA", 0}, {"a", "TestB", 0}, {"a", "TestNew", 0}},
+			shards:    2,
+			want:      [][]string{{"TestA"}, {"TestNew", "TestB"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planShards(addUnknownTests(tt.durations, tt.listed), tt.shards)
+
+			var got [][]string
+			for _, s := range plan {
+				got = append(got, s.Tests)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planShards() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
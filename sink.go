@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// sink is a destination the results of a collection are written to
+type sink interface {
+	write(ctx context.Context, db *sql.DB) error
+}
+
+// newSink returns the sink named by a --sink value: sqlite, stdout-json or an http(s) URL
+func newSink(spec string, opts options) (sink, error) {
+	switch {
+	case spec == "sqlite":
+		return sqliteSink{dbFile: opts.dbFile, noVacuum: opts.noVacuum}, nil
+	case spec == "stdout-json":
+		return jsonSink{w: os.Stdout}, nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return httpSink{url: spec}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink: %q", spec)
+	}
+}
+
+// newSinks validates the --sink values before the collection starts
+func newSinks(opts options) ([]sink, error) {
+	var sinks []sink
+	for _, spec := range opts.sinks {
+		s, err := newSink(spec, opts)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// writeSinks writes the database to every sink, stopping at the first failure
+func writeSinks(ctx context.Context, db *sql.DB, sinks []sink, specs []string) error {
+	for i, s := range sinks {
+		err := s.write(ctx, db)
+		if err != nil {
+			return fmt.Errorf("failed to write to sink %s: %w", specs[i], err)
+		}
+	}
+	return nil
+}
+
+// sqliteSink saves the database to a file, like --persist
+type sqliteSink struct {
+	dbFile   string
+	noVacuum bool
+}
+
+func (s sqliteSink) write(ctx context.Context, db *sql.DB) error {
+	return persistDatabase(ctx, db, s.dbFile, s.noVacuum)
+}
+
+// jsonSink writes every row of every table as a JSON line: {"table": "all_tests", "row": {...}}
+type jsonSink struct {
+	w io.Writer
+}
+
+func (s jsonSink) write(ctx context.Context, db *sql.DB) error {
+	return writeRecords(ctx, db, s.w)
+}
+
+// httpSink posts the JSON lines of jsonSink to a collector
+type httpSink struct {
+	url string
+}
+
+func (s httpSink) write(ctx context.Context, db *sql.DB) error {
+	var body bytes.Buffer
+	err := writeRecords(ctx, db, &body)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// sinkRecord is a single row of a table as written by the JSON sinks
+type sinkRecord struct {
+	Table string         `json:"table"`
+	Row   map[string]any `json:"row"`
+}
+
+// writeRecords encodes the rows of every table of the database as JSON lines
+func writeRecords(ctx context.Context, db *sql.DB, w io.Writer) error {
+	tables, err := listTables(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, table := range tables {
+		err := writeTableRecords(ctx, db, enc, table)
+		if err != nil {
+			return fmt.Errorf("failed to export table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// listTables returns the names of the tables of the database in creation order
+func listTables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY rowid;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read table name: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+func writeTableRecords(ctx context.Context, db *sql.DB, enc *json.Encoder, table string) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %q;", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		values := make([]any, len(columns))
+		valuesPtr := make([]any, len(columns))
+		for i := range values {
+			valuesPtr[i] = &values[i]
+		}
+		if err := rows.Scan(valuesPtr...); err != nil {
+			return err
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			// only blobs are scanned as bytes, text comes as strings. They are hex encoded like
+			// formatValue does with --full, rather than in the base64 of encoding/json.
+			if b, ok := values[i].([]byte); ok {
+				values[i] = hex.EncodeToString(b)
+			}
+			row[column] = values[i]
+		}
+
+		err := enc.Encode(sinkRecord{Table: table, Row: row})
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
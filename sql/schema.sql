@@ -4,7 +4,8 @@
 		package TEXT NOT NULL,
         test TEXT NOT NULL,
         elapsed NUMERIC NULL,
-        "output" TEXT NULL
+        "output" TEXT NULL,
+        seq INTEGER NULL
 	);
 
     CREATE TABLE all_coverage (
@@ -32,6 +33,67 @@
 		function_name TEXT NULL
 	);
 
+	CREATE TABLE test_failures (
+		package TEXT NOT NULL,
+		test TEXT NOT NULL,
+		output TEXT NOT NULL,
+		message TEXT NULL,
+		expected TEXT NULL,
+		actual TEXT NULL
+	);
+
+	CREATE TABLE run_metadata (
+		run_id TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (run_id, key)
+	);
+
+	CREATE TABLE generic_functions (
+		file TEXT NOT NULL,
+		function_name TEXT NOT NULL,
+		receiver TEXT NULL,
+		type_params TEXT NOT NULL,
+		start_line INTEGER NOT NULL,
+		end_line INTEGER NOT NULL,
+		instantiations TEXT NULL
+	);
+
+	CREATE TABLE test_functions (
+		file TEXT NOT NULL,
+		function_name TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		start_line INTEGER NOT NULL,
+		end_line INTEGER NOT NULL,
+		is_helper BOOLEAN NOT NULL,
+		has_assertions BOOLEAN NOT NULL
+	);
+
+	CREATE TABLE embeds (
+		file TEXT NOT NULL,
+		line INTEGER NOT NULL,
+		variable TEXT NOT NULL,
+		pattern TEXT NOT NULL,
+		resolved_file TEXT NULL
+	);
+
+	CREATE TABLE package_dirs (
+		package TEXT NOT NULL,
+		module TEXT NOT NULL,
+		dir TEXT NOT NULL
+	);
+
+	CREATE TABLE excluded_packages (
+		pattern TEXT NOT NULL,
+		package TEXT NULL
+	);
+
+	CREATE TABLE collector_errors (
+		phase TEXT NOT NULL,
+		file TEXT NOT NULL,
+		error TEXT NOT NULL
+	);
+
 	CREATE TABLE all_code (
 		package TEXT NOT NULL,
 		file TEXT NOT NULL,
@@ -55,4 +117,100 @@ select package, function_name, file, start_line, start_col, end_line, end_col
  where count = 0;
 
  create view code_coverage as
- select distinct ac.file, line_number, content, ifnull(count, 0) covered from all_code ac left join all_coverage cov on ac.file = cov.file and ac.line_number between cov.start_line and cov.end_line where ac.file not like '%_test.go';
\ No newline at end of file
+ select distinct ac.file, line_number, content, ifnull(count, 0) covered from all_code ac left join package_dirs pd on pd.dir = ac.package left join all_coverage cov on ac.file = cov.file and cov.package = ifnull(pd.package, cov.package) and ac.line_number between cov.start_line and cov.end_line where ac.file not like '%_test.go';
+
+create view coverage_by_dir as
+with recursive
+  package_totals(module, path, statements, covered) as (
+    select d.module,
+           case when c.package = d.module then '' else substr(c.package, length(d.module) + 2) end,
+           sum(c.stmt_num), sum(case when c.count > 0 then c.stmt_num else 0 end)
+      from all_coverage c
+      join package_dirs d on d.package = c.package
+     group by c.package
+  ),
+  dirs(module, dir, rest, path) as (
+    select module, '.', path, path
+      from package_totals
+     union all
+    select module,
+           case when dir = '.' then '' else dir || '/' end || substr(rest || '/', 1, instr(rest || '/', '/') - 1),
+           substr(rest, instr(rest || '/', '/') + 1),
+           path
+      from dirs
+     where rest <> ''
+  )
+select d.module,
+       d.dir,
+       case when d.dir = '.' then 0 else length(d.dir) - length(replace(d.dir, '/', '')) + 1 end depth,
+       count(*) packages,
+       sum(p.statements) statements,
+       sum(p.covered) covered_statements,
+       round(sum(p.covered) * 100.0 / sum(p.statements), 2) coverage
+  from dirs d
+  join package_totals p on p.module = d.module and p.path = d.path
+ group by d.module, d.dir;
+
+create view whitespace_only_failures as
+select package, test, message, expected, actual
+  from test_failures
+ where expected <> actual
+   and replace(replace(replace(replace(expected, ' ', ''), char(9), ''), char(10), ''), char(13), '') =
+       replace(replace(replace(replace(actual, ' ', ''), char(9), ''), char(10), ''), char(13), '');
+
+create view failure_predecessors as
+select f.package, f.test, f.seq, p.test predecessor, p.seq predecessor_seq, f.seq - p.seq distance, p.action predecessor_action
+  from all_tests f
+  join all_tests p on p.package = f.package and p.seq < f.seq
+ where f.action = 'fail'
+   and f.test not like p.test || '/%';
+
+create view function_test_counts as
+select f.package, f.file, f.function_name,
+       count(distinct tc.test_name) tests,
+       round(count(distinct tc.test_name) * 100.0 / max((select count(distinct test) from all_tests), 1), 2) suite_share
+  from (select distinct package, file, function_name from all_coverage where function_name <> '') f
+  left join test_coverage tc on tc.package = f.package and tc.file = f.file and tc.function_name = f.function_name and tc.count > 0
+ group by f.package, f.file, f.function_name;
+
+create view generic_coverage as
+select c.package, c.file, c.function_name, g.receiver, c.start_line, c.start_col, c.end_line, c.end_col, c.stmt_num, c.count,
+       g.type_params, g.instantiations,
+       'coverage is shared by every instantiation' note
+  from all_coverage c
+  join generic_functions g on g.file = c.file and c.start_line between g.start_line and g.end_line;
+
+create view unexercised_embeds as
+select e.file, e.line, e.variable, e.pattern, e.resolved_file
+  from embeds e
+ where not exists (
+       select 1
+         from all_code ac
+         left join package_dirs pd on pd.dir = ac.package
+         join all_coverage cov on cov.file = ac.file and cov.package = ifnull(pd.package, cov.package) and ac.line_number between cov.start_line and cov.end_line
+        where cov.count > 0
+          and ' ' || ac.content || ' ' glob '*[^A-Za-z0-9_]' || e.variable || '[^A-Za-z0-9_]*'
+       );
+
+create view tests_without_assertions as
+select file, function_name, start_line, end_line
+  from test_functions
+ where kind = 'test'
+   and not is_helper
+   and not has_assertions;
+
+create view test_duration_stats as
+select t.package,
+       count(*) tests,
+       round(sum(t.elapsed), 3) total_elapsed,
+       round(avg(t.elapsed), 3) avg_elapsed,
+       max(t.elapsed) max_elapsed
+  from all_tests t
+ where t.test not like '%/%'
+   and not exists (
+       select 1
+         from test_functions f
+        where f.function_name = t.test
+          and f.is_helper
+       )
+ group by t.package;
\ No newline at end of file
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the name of the driver every connection of tq is opened with
+const sqliteDriver = "sqlite3_tq"
+
+// connectHooks are run on every new connection, e.g. to register the functions bundled at compile time
+var connectHooks []func(conn *sqlite3.SQLiteConn) error
+
+// driver loads the extensions given with --sqlite-extension into every new connection
+var driver = &sqlite3.SQLiteDriver{
+	ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+		for _, hook := range connectHooks {
+			if err := hook(conn); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	sql.Register(sqliteDriver, driver)
+}
+
+// useExtensions sets the shared libraries loaded into the connections opened from now on
+func useExtensions(extensions []string) {
+	driver.Extensions = extensions
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// suggestedTestsLimit is the number of existing tests suggested for each uncovered block
+const suggestedTestsLimit = 3
+
+// majorVersionRegexp matches the major version element of an import path, like v2
+var majorVersionRegexp = regexp.MustCompile(`^v\d+$`)
+
+// UncoveredBlock is a function or branch of a file no test executes
+type UncoveredBlock struct {
+	Kind         string
+	FunctionName string
+	StartLine    int
+	EndLine      int
+	Tests        []string
+}
+
+func suggestCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("suggest", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	file := flags.String("file", "", "source file to suggest tests for")
+	flags.Parse(args)
+
+	if *file == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	db, err := loadDatabase(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// files of different packages may share a name, coverage is restricted to the package of the file
+	dir, fileName := filepath.Dir(*file), filepath.Base(*file)
+	blocks, err := collectUncoveredBlocks(ctx, db, dir, fileName)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		fmt.Println("no uncovered code found in", *file)
+		return nil
+	}
+
+	graph, err := collectCallers(dir)
+	if err != nil {
+		return err
+	}
+
+	for i := range blocks {
+		callers := graph.callers[graph.declAt(fileName, blocks[i].StartLine)]
+		blocks[i].Tests, err = nearestTests(ctx, db, dir, fileName, blocks[i], callers)
+		if err != nil {
+			return err
+		}
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"kind", "function", "lines", "nearest tests"})
+	for _, b := range blocks {
+		tests := strings.Join(b.Tests, "\n")
+		if tests == "" {
+			tests = "-"
+		}
+		t.AppendRow(table.Row{b.Kind, b.FunctionName, fmt.Sprintf("%d-%d", b.StartLine, b.EndLine), tests})
+	}
+	t.Render()
+
+	return nil
+}
+
+// collectUncoveredBlocks lists the uncovered blocks of a file. Functions without any covered block are
+// reported once as a whole, uncovered blocks of partially covered functions are reported as branches.
+func collectUncoveredBlocks(ctx context.Context, db *sql.DB, dir, file string) ([]UncoveredBlock, error) {
+	query := `SELECT function_name, min(start_line), max(end_line), 'function'
+		FROM all_coverage WHERE file = ? AND ` + coveragePackageFilter + ` GROUP BY function_name HAVING max(count) = 0
+		UNION ALL
+		SELECT c.function_name, c.start_line, c.end_line, 'branch'
+		FROM all_coverage c WHERE c.file = ? AND c.` + coveragePackageFilter + ` AND c.count = 0
+		AND EXISTS (SELECT 1 FROM all_coverage o WHERE o.package = c.package AND o.file = c.file AND o.function_name = c.function_name AND o.count > 0)
+		ORDER BY 2;`
+	rows, err := db.QueryContext(ctx, query, file, dir, file, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query uncovered code: %w", err)
+	}
+	defer rows.Close()
+
+	var blocks []UncoveredBlock
+	for rows.Next() {
+		var b UncoveredBlock
+		if err := rows.Scan(&b.FunctionName, &b.StartLine, &b.EndLine, &b.Kind); err != nil {
+			return nil, fmt.Errorf("failed to read uncovered code: %w", err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
+
+// nearestTests ranks the existing tests of the package closest to an uncovered block: first the tests
+// covering the functions calling it, then the tests covering the lines nearest to it in the same file.
+// At most suggestedTestsLimit tests are returned.
+func nearestTests(ctx context.Context, db *sql.DB, dir, file string, block UncoveredBlock, callers []string) ([]string, error) {
+	var tests []string
+	seen := make(map[string]bool)
+
+	for _, caller := range callers {
+		if len(tests) >= suggestedTestsLimit {
+			return tests, nil
+		}
+
+		var test string
+		err := db.QueryRowContext(ctx, `SELECT test_name FROM test_coverage WHERE function_name = ? AND `+coveragePackageFilter+` AND count > 0 ORDER BY test_name LIMIT 1;`, caller, dir).Scan(&test)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query caller tests: %w", err)
+		}
+		if !seen[test] {
+			seen[test] = true
+			tests = append(tests, fmt.Sprintf("%s (via %s)", test, caller))
+		}
+	}
+
+	query := `SELECT test_name, min(abs(start_line - ?)) distance FROM test_coverage
+		WHERE file = ? AND ` + coveragePackageFilter + ` AND count > 0 GROUP BY test_name ORDER BY distance, test_name;`
+	rows, err := db.QueryContext(ctx, query, block.StartLine, file, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query nearby tests: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() && len(tests) < suggestedTestsLimit {
+		var test string
+		var distance int
+		if err := rows.Scan(&test, &distance); err != nil {
+			return nil, fmt.Errorf("failed to read nearby tests: %w", err)
+		}
+		if !seen[test] {
+			seen[test] = true
+			tests = append(tests, fmt.Sprintf("%s (line distance %d)", test, distance))
+		}
+	}
+
+	return tests, rows.Err()
+}
+
+// callGraph maps the functions and methods declared in the non-test files of a package to the
+// functions of the package calling them. Without type information methods are keyed by name only,
+// calls to other packages are left out.
+type callGraph struct {
+	callers map[string][]string
+	decls   map[string][]funcRange
+}
+
+// funcRange is the key and line range of a function declaration
+type funcRange struct {
+	key        string
+	start, end int
+}
+
+// callKey keys a function declared in the package, or a method of any of its types
+func callKey(name string, method bool) string {
+	if method {
+		return "method " + name
+	}
+	return "func " + name
+}
+
+// declAt returns the key of the function declared at a line of a file
+func (g callGraph) declAt(file string, line int) string {
+	for _, decl := range g.decls[file] {
+		if decl.start <= line && line <= decl.end {
+			return decl.key
+		}
+	}
+	return ""
+}
+
+// collectCallers parses the non-test files of a directory and builds its call graph
+func collectCallers(dir string) (callGraph, error) {
+	graph := callGraph{callers: make(map[string][]string), decls: make(map[string][]funcRange)}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return graph, err
+	}
+
+	fs := token.NewFileSet()
+	for _, fileName := range files {
+		if strings.HasSuffix(fileName, "_test.go") {
+			continue
+		}
+
+		node, err := parser.ParseFile(fs, fileName, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return graph, fmt.Errorf("failed to parse file: %w", err)
+		}
+
+		imports := make(map[string]bool)
+		for _, spec := range node.Imports {
+			imports[importName(spec)] = true
+		}
+
+		for _, decl := range node.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Body == nil {
+				continue
+			}
+
+			key := callKey(funcDecl.Name.Name, funcDecl.Recv != nil)
+			graph.decls[filepath.Base(fileName)] = append(graph.decls[filepath.Base(fileName)], funcRange{
+				key:   key,
+				start: fs.Position(funcDecl.Pos()).Line,
+				end:   fs.Position(funcDecl.End()).Line,
+			})
+
+			called := make(map[string]bool)
+			ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					switch fn := call.Fun.(type) {
+					case *ast.Ident:
+						called[callKey(fn.Name, false)] = true
+					case *ast.SelectorExpr:
+						// pkg.Func calls into another package, anything else is a method call
+						if x, ok := fn.X.(*ast.Ident); !ok || !imports[x.Name] {
+							called[callKey(fn.Sel.Name, true)] = true
+						}
+					}
+				}
+				return true
+			})
+
+			for callee := range called {
+				if callee != key {
+					graph.callers[callee] = append(graph.callers[callee], funcDecl.Name.Name)
+				}
+			}
+		}
+	}
+
+	for name := range graph.callers {
+		sort.Strings(graph.callers[name])
+	}
+	return graph, nil
+}
+
+// importName returns the name an import is referred to by: its alias, or the last element of its
+// path without a major version suffix, which matches the package name of most modules
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+
+	importPath, _ := strconv.Unquote(spec.Path.Value)
+	elements := strings.Split(importPath, "/")
+	name := elements[len(elements)-1]
+	if len(elements) > 1 && majorVersionRegexp.MatchString(name) {
+		name = elements[len(elements)-2]
+	}
+	name, _, _ = strings.Cut(name, ".")
+	return strings.TrimPrefix(name, "go-")
+}
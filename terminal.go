@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/chzyer/readline"
+)
+
+// lineReader reads the statements typed in the interactive prompt
+type lineReader interface {
+	Readline() (string, error)
+	SetPrompt(prompt string)
+	SaveHistory(content string) error
+	Close() error
+}
+
+// newLineReader returns a readline instance when stdin is a terminal, falling back to plain
+// line reading otherwise (CI, editors, pipes) or when noTTY is set
+func newLineReader(noTTY bool) (lineReader, error) {
+	if noTTY || !readline.IsTerminal(int(os.Stdin.Fd())) {
+		return newPlainReader(os.Stdin), nil
+	}
+
+	return readline.NewEx(&readline.Config{
+		Prompt:                 "> ",
+		HistoryFile:            "/tmp/testquery-history",
+		DisableAutoSaveHistory: true,
+	})
+}
+
+// plainReader reads lines without prompts, escape sequences or history
+type plainReader struct {
+	scanner *bufio.Scanner
+}
+
+func newPlainReader(r io.Reader) *plainReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &plainReader{scanner: scanner}
+}
+
+func (p *plainReader) Readline() (string, error) {
+	if !p.scanner.Scan() {
+		if err := p.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return p.scanner.Text(), nil
+}
+
+func (p *plainReader) SetPrompt(string) {}
+
+func (p *plainReader) SaveHistory(string) error { return nil }
+
+func (p *plainReader) Close() error { return nil }
@@ -3,12 +3,18 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"log"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 
 	"golang.org/x/tools/cover"
 )
@@ -25,42 +31,304 @@ type TestCoverageResult struct {
 	StatementNumber int    `json:"stmt_num"`
 	Count           int    `json:"count"`
 	FunctionName    string `json:"function_name"`
+
+	// Mode is the mode of the profile the result was parsed from, which depends on the strategy
+	Mode string `json:"-"`
 }
 
-func collectTestCoverageResults(pkgDir string, testResults []TestEvent) ([]TestCoverageResult, error) {
-	var results []TestCoverageResult
+// Per-test coverage strategies
+const (
+	// perTestProcess runs `go test` once per test, rebuilding the test binary every time
+	perTestProcess = "process"
 
-	for _, test := range testResults {
-		cmd := exec.Command("go", "test", pkgDir, "-run", "^"+test.Test+"$", "-coverprofile="+test.Test+".out")
-		cmd.Run()
+	// perTestBinary builds the coverage instrumented test binary once and runs every test in a single
+	// process, taking a snapshot of the coverage counters after each test
+	perTestBinary = "binary"
+)
+
+// perTestMain is the TestMain added to the package through an overlay by the binary strategy. It runs
+// the tests listed in TESTQUERY_TESTS one at a time and writes the coverage counters of the i-th test
+// to TESTQUERY_COVERDIR/i. Imports are renamed so they can't clash with the identifiers of the package.
+const perTestMain = `package %s
+
+import (
+	tqflag "flag"
+	tqos "os"
+	tqfilepath "path/filepath"
+	tqcoverage "runtime/coverage"
+	tqstrconv "strconv"
+	tqstrings "strings"
+	tqtesting "testing"
+)
+
+func TestMain(m *tqtesting.M) {
+	tqflag.Parse()
+	code := 0
+	for i, test := range tqstrings.Split(tqos.Getenv("TESTQUERY_TESTS"), "\n") {
+		tqcoverage.ClearCounters()
+		tqflag.Set("test.run", "^"+test+"$")
+		if c := m.Run(); c != 0 {
+			code = c
+		}
+
+		dir := tqfilepath.Join(tqos.Getenv("TESTQUERY_COVERDIR"), tqstrconv.Itoa(i))
+		if tqos.MkdirAll(dir, 0755) == nil {
+			tqcoverage.WriteMetaDir(dir)
+			tqcoverage.WriteCountersDir(dir)
+		}
+	}
+	tqos.Exit(code)
+}
+`
+
+// testCoverageRunner runs a single test writing its coverage profile to profileFile
+type testCoverageRunner func(test, profileFile string) error
+
+// newTestCoverageRunner returns the runner implementing the per-test coverage strategy and a
+// function releasing its resources
+func newTestCoverageRunner(pkgDir, strategy string, tests []string) (testCoverageRunner, func(), error) {
+	switch strategy {
+	case "", perTestProcess:
+		runner := func(test, profileFile string) error {
+			cmd := exec.Command("go", "test", pkgDir, "-run", "^"+test+"$", "-coverprofile="+profileFile)
+			cmd.Run()
+			return nil
+		}
+		return runner, func() {}, nil
+	case perTestBinary:
+		tmpDir, err := os.MkdirTemp("", "testquery")
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanup := func() { os.RemoveAll(tmpDir) }
+
+		hasTestMain, err := detectTestMain(pkgDir)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+
+		var runner testCoverageRunner
+		switch {
+		case hasTestMain:
+			log.Println("package declares TestMain: the binary strategy runs the test binary once per test")
+			runner, err = perTestBinaryRunner(pkgDir, tmpDir)
+		case len(tests) == 0:
+			runner, err = perTestBinaryRunner(pkgDir, tmpDir)
+		default:
+			runner, err = snapshotRunner(pkgDir, tmpDir, tests)
+		}
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		return runner, cleanup, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown per-test coverage strategy: %q", strategy)
+	}
+}
 
-		profiles, err := cover.ParseProfiles(test.Test + ".out")
+// perTestBinaryRunner builds the coverage instrumented test binary once and runs it once per test
+func perTestBinaryRunner(pkgDir, tmpDir string) (testCoverageRunner, error) {
+	binary := filepath.Join(tmpDir, "pkg.test")
+	output, err := exec.Command("go", "test", "-c", "-cover", "-o", binary, pkgDir).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build test binary: %w: %s", err, output)
+	}
+
+	runner := func(test, profileFile string) error {
+		absProfile, err := filepath.Abs(profileFile)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		for _, profile := range profiles {
-			packageName := filepath.Dir(profile.FileName)
-			fileName := filepath.Base(profile.FileName)
-			for _, block := range profile.Blocks {
-				functionName, err := getFunctionName(pkgDir+"/"+fileName, block.StartLine)
-				if err != nil {
-					return nil, fmt.Errorf("failed to retrieve function name: %w", err)
-				}
-
-				results = append(results, TestCoverageResult{
-					TestName:        test.Test,
-					Package:         packageName,
-					File:            fileName,
-					StartLine:       block.StartLine,
-					StartColumn:     block.StartCol,
-					EndLine:         block.EndLine,
-					EndColumn:       block.EndCol,
-					StatementNumber: block.NumStmt,
-					Count:           block.Count,
-					FunctionName:    functionName,
-				})
+		// like go test, run the binary from the package directory
+		cmd := exec.Command(binary, "-test.run", "^"+test+"$", "-test.coverprofile="+absProfile)
+		cmd.Dir = pkgDir
+		cmd.Run()
+		return nil
+	}
+	return runner, nil
+}
+
+// snapshotRunner builds the test binary with perTestMain and runs all the tests in a single process.
+// The runner then converts the counters of a test into its profile, running the test again on its own
+// when the single run stopped before reaching it, e.g. because an earlier test panicked.
+func snapshotRunner(pkgDir, tmpDir string, tests []string) (testCoverageRunner, error) {
+	pkgName, err := testPackageName(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	mainFile := filepath.Join(tmpDir, "main_test.go")
+	err = os.WriteFile(mainFile, []byte(fmt.Sprintf(perTestMain, pkgName)), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	absPkgDir, err := filepath.Abs(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+	overlay, err := json.Marshal(map[string]any{
+		"Replace": map[string]string{filepath.Join(absPkgDir, "testquery_main_test.go"): mainFile},
+	})
+	if err != nil {
+		return nil, err
+	}
+	overlayFile := filepath.Join(tmpDir, "overlay.json")
+	err = os.WriteFile(overlayFile, overlay, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// clearing the counters between tests needs the atomic mode
+	binary := filepath.Join(tmpDir, "pkg.test")
+	output, err := exec.Command("go", "test", "-c", "-covermode=atomic", "-overlay", overlayFile, "-o", binary, pkgDir).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build test binary: %w: %s", err, output)
+	}
+
+	// run writes the counters of the given tests under coverDir, like go test from the package directory
+	run := func(coverDir string, tests []string) {
+		cmd := exec.Command(binary)
+		cmd.Dir = pkgDir
+		cmd.Env = append(os.Environ(), "TESTQUERY_TESTS="+strings.Join(tests, "\n"), "TESTQUERY_COVERDIR="+coverDir)
+		cmd.Run()
+	}
+
+	index := make(map[string]int, len(tests))
+	for i, test := range tests {
+		index[test] = i
+	}
+	run(filepath.Join(tmpDir, "all"), tests)
+
+	runner := func(test, profileFile string) error {
+		i, ok := index[test]
+		if !ok {
+			return fmt.Errorf("test %s is not part of the run", test)
+		}
+
+		counters := filepath.Join(tmpDir, "all", strconv.Itoa(i))
+		if _, err := os.Stat(counters); err != nil {
+			rerunDir := filepath.Join(tmpDir, "rerun", strconv.Itoa(i))
+			run(rerunDir, []string{test})
+			counters = filepath.Join(rerunDir, "0")
+		}
+
+		// a missing profile is reported when it is parsed, like with the other strategies
+		exec.Command("go", "tool", "covdata", "textfmt", "-i="+counters, "-o="+profileFile).Run()
+		return nil
+	}
+	return runner, nil
+}
+
+// testPackageName returns the package name of the test files of a package, which the TestMain added by
+// the binary strategy must share
+func testPackageName(pkgDir string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(pkgDir, "*_test.go"))
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no test files in %s", pkgDir)
+	}
+
+	node, err := parser.ParseFile(token.NewFileSet(), files[0], nil, parser.PackageClauseOnly)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse file: %w", err)
+	}
+	return node.Name.Name, nil
+}
+
+func collectTestCoverageResults(pkgDir string, testResults []TestEvent, strategy string, jobs *jobLimiter, errs *collectorErrors) ([]TestCoverageResult, error) {
+	tests := make([]string, len(testResults))
+	for i, test := range testResults {
+		tests[i] = test.Test
+	}
+
+	runTest, cleanup, err := newTestCoverageRunner(pkgDir, strategy, tests)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	profiles := make([]string, len(testResults))
+	for i, test := range testResults {
+		profiles[i] = test.Test + ".out"
+	}
+	err = writeProfileManifest(profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	// results are kept per test so their order doesn't depend on scheduling
+	results := make([][]TestCoverageResult, len(testResults))
+	runErrs := make([]error, len(testResults))
+
+	var wg sync.WaitGroup
+	for i, test := range testResults {
+		jobs.acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer jobs.release()
+			results[i], runErrs[i] = collectTestCoverage(pkgDir, test.Test, runTest, errs)
+		}()
+	}
+	wg.Wait()
+
+	_, err = removeStaleProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var all []TestCoverageResult
+	for i := range testResults {
+		if runErrs[i] != nil {
+			return nil, runErrs[i]
+		}
+		all = append(all, results[i]...)
+	}
+	return all, nil
+}
+
+// collectTestCoverage runs a single test and parses its coverage profile
+func collectTestCoverage(pkgDir, test string, runTest testCoverageRunner, errs *collectorErrors) ([]TestCoverageResult, error) {
+	err := runTest(test, test+".out")
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", test, err)
+	}
+
+	profiles, err := cover.ParseProfiles(test + ".out")
+	if err != nil {
+		errs.add("test_coverage", test+".out", err)
+		return nil, nil
+	}
+
+	var results []TestCoverageResult
+	for _, profile := range profiles {
+		packageName := filepath.Dir(profile.FileName)
+		fileName := filepath.Base(profile.FileName)
+		for _, block := range profile.Blocks {
+			functionName, err := getFunctionName(pkgDir+"/"+fileName, block.StartLine)
+			if err != nil {
+				errs.add("test_coverage", pkgDir+"/"+fileName, fmt.Errorf("failed to retrieve function name: %w", err))
 			}
+
+			results = append(results, TestCoverageResult{
+				TestName:        test,
+				Package:         packageName,
+				File:            fileName,
+				StartLine:       block.StartLine,
+				StartColumn:     block.StartCol,
+				EndLine:         block.EndLine,
+				EndColumn:       block.EndCol,
+				StatementNumber: block.NumStmt,
+				Count:           block.Count,
+				FunctionName:    functionName,
+				Mode:            profile.Mode,
+			})
 		}
 	}
 
@@ -88,19 +356,23 @@ func getFunctionName(fileName string, lineNumber int) (string, error) {
 	return "", nil
 }
 
-func populateTestCoverageResults(ctx context.Context, db *sql.DB, pkgDir string, testResults []TestEvent) error {
-	testCoverageResults, err := collectTestCoverageResults(pkgDir, testResults)
+// populateTestCoverageResults inserts the coverage of every test and returns the mode of their
+// profiles, or an empty string when no profile was collected
+func populateTestCoverageResults(ctx context.Context, db *sql.DB, pkgDir string, testResults []TestEvent, strategy string, jobs *jobLimiter, errs *collectorErrors) (string, error) {
+	testCoverageResults, err := collectTestCoverageResults(pkgDir, testResults, strategy, jobs, errs)
 	if err != nil {
-		return fmt.Errorf("failed to collect coverage results by test: %w", err)
+		return "", fmt.Errorf("failed to collect coverage results by test: %w", err)
 	}
 
+	var mode string
 	for _, result := range testCoverageResults {
+		mode = result.Mode
 		insertSQL := `INSERT INTO test_coverage (test_name, package, file, start_line, start_col, end_line, end_col, stmt_num, count, function_name) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 		_, err := db.ExecContext(ctx, insertSQL, result.TestName, result.Package, result.File, result.StartLine, result.StartColumn, result.EndLine, result.EndColumn, result.StatementNumber, result.Count, result.FunctionName)
 		if err != nil {
-			return fmt.Errorf("failed to insert test coverage results: %w", err)
+			return "", fmt.Errorf("failed to insert test coverage results: %w", err)
 		}
 	}
 
-	return nil
+	return mode, nil
 }
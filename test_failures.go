@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// locationRegexp matches the "file.go:42: " prefix of messages logged by t.Error and friends
+	locationRegexp = regexp.MustCompile(`^[\w.\-]+\.go:\d+: (.*)$`)
+
+	// gotWantRegexp matches messages like "got 1, want 2" or "actual: 1 expected: 2"
+	gotWantRegexp = regexp.MustCompile(`(?i)\b(?:got|actual|have)\b:?\s*(.*?),?\s+(?:but\s+|while\s+)?(?:want|wanted|expected)\b:?\s*(.*)$`)
+
+	// wantGotRegexp matches messages like "want 2, got 1" or "expected 2, but got 1"
+	wantGotRegexp = regexp.MustCompile(`(?i)\b(?:want|wanted|expected)\b:?\s*(.*?),?\s+(?:but\s+|while\s+)?(?:got|actual|have)\b:?\s*(.*)$`)
+
+	// labelRegexp matches a line holding only a label, with the value on the following line
+	labelRegexp = regexp.MustCompile(`(?i)^(got|actual|have|want|wanted|expected):?$`)
+
+	// diffHeaderRegexp matches the header printed before a cmp.Diff result
+	diffHeaderRegexp = regexp.MustCompile(`\((-want \+got|-got \+want|-expected \+actual|-actual \+expected)\)`)
+
+	// quotedValueRegexp matches a %q formatted value ending a string
+	quotedValueRegexp = regexp.MustCompile(`"(?:[^"\\]|\\.)*"$`)
+)
+
+// TestFailure represents a failed test with the expected and actual values parsed from its output
+type TestFailure struct {
+	Package  string
+	Test     string
+	Output   string
+	Message  *string
+	Expected *string
+	Actual   *string
+}
+
+// collectTestFailures gathers the output of every failed test and parses the first assertion found in it
+func collectTestFailures(events []TestEvent) []TestFailure {
+	type testKey struct{ pkg, test string }
+	outputs := make(map[testKey][]string)
+	for _, event := range events {
+		if event.Action == "output" && event.Test != "" && event.Output != nil {
+			key := testKey{event.Package, event.Test}
+			outputs[key] = append(outputs[key], *event.Output)
+		}
+	}
+
+	var results []TestFailure
+	for _, test := range collectTestResults(events) {
+		if test.Action != "fail" {
+			continue
+		}
+
+		lines := outputs[testKey{test.Package, test.Test}]
+		failure := TestFailure{
+			Package: test.Package,
+			Test:    test.Test,
+			Output:  strings.Join(lines, ""),
+		}
+		failure.Message, failure.Expected, failure.Actual = parseAssertion(lines)
+		results = append(results, failure)
+	}
+
+	return results
+}
+
+// parseAssertion looks for the first got/want pair in the output of a test. It understands single line
+// messages ("got X, want Y", "expected X, but got Y"), labels on their own lines followed by the values
+// and cmp.Diff style blocks, where removed and added lines become the expected and actual values.
+func parseAssertion(lines []string) (message, expected, actual *string) {
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		m := locationRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		msg := m[1]
+
+		if d := diffHeaderRegexp.FindStringSubmatch(msg); d != nil {
+			removed, added := parseDiffBlock(lines[i+1:])
+			if strings.HasPrefix(d[1], "-want") || strings.HasPrefix(d[1], "-expected") {
+				return &msg, &removed, &added
+			}
+			return &msg, &added, &removed
+		}
+
+		if w, g, ok := matchGotWant(msg); ok {
+			return &msg, &w, &g
+		}
+
+		// labels followed by the values on the next lines, e.g. "got:\n\t1\nwant:\n\t2"
+		if w, g, ok := parseLabels(append([]string{msg}, lines[i+1:]...)); ok {
+			return &msg, &w, &g
+		}
+	}
+
+	// no recognizable assertion, keep the first logged message if any
+	for _, line := range lines {
+		if m := locationRegexp.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			return &m[1], nil, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// matchGotWant applies whichever of the got/want patterns matches earlier in the message
+func matchGotWant(msg string) (want, got string, ok bool) {
+	gw := gotWantRegexp.FindStringSubmatchIndex(msg)
+	wg := wantGotRegexp.FindStringSubmatchIndex(msg)
+
+	switch {
+	case gw != nil && (wg == nil || gw[0] <= wg[0]):
+		return strings.TrimSpace(msg[gw[4]:gw[5]]), leadingValue(msg[gw[2]:gw[3]]), true
+	case wg != nil:
+		return leadingValue(msg[wg[2]:wg[3]]), strings.TrimSpace(msg[wg[4]:wg[5]]), true
+	}
+	return "", "", false
+}
+
+// leadingValue extracts the value ending the text between the first label and the second one, which
+// may hold more words, e.g. 10 in "expected result 10, but got 1". The value is a quoted string, a
+// %v formatted composite like []int{1, 2} or map[a:1], or else the last word.
+func leadingValue(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return text
+	}
+
+	if m := quotedValueRegexp.FindString(text); m != "" {
+		return m
+	}
+
+	start := strings.LastIndexAny(text, " \t") + 1
+	if last := text[len(text)-1]; last == ']' || last == '}' {
+		// find the bracket opening the composite, then keep its type prefix
+		depth := 0
+		for i := len(text) - 1; i >= 0; i-- {
+			switch text[i] {
+			case ']', '}':
+				depth++
+			case '[', '{':
+				depth--
+			}
+			if depth == 0 {
+				start = strings.LastIndexAny(text[:i], " \t") + 1
+				break
+			}
+		}
+	}
+	return text[start:]
+}
+
+// parseLabels reads values printed on the line following a "got:" or "want:" label
+func parseLabels(lines []string) (want, got string, ok bool) {
+	var hasWant, hasGot bool
+	for i := 0; i < len(lines)-1; i++ {
+		m := labelRegexp.FindStringSubmatch(strings.TrimSpace(lines[i]))
+		if m == nil {
+			if locationRegexp.MatchString(strings.TrimSpace(lines[i])) && i > 0 {
+				break
+			}
+			continue
+		}
+
+		value := strings.TrimSpace(lines[i+1])
+		switch strings.ToLower(m[1]) {
+		case "got", "actual", "have":
+			got, hasGot = value, true
+		default:
+			want, hasWant = value, true
+		}
+		i++
+	}
+	return want, got, hasWant && hasGot
+}
+
+// parseDiffBlock splits the lines of a cmp.Diff result into the removed and added text
+func parseDiffBlock(lines []string) (removed, added string) {
+	var rem, add []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if locationRegexp.MatchString(trimmed) || strings.HasPrefix(trimmed, "--- FAIL") || strings.HasPrefix(trimmed, "=== ") {
+			break
+		}
+		if len(trimmed) == 0 {
+			continue
+		}
+
+		switch trimmed[0] {
+		case '-':
+			rem = append(rem, strings.TrimSpace(trimmed[1:]))
+		case '+':
+			add = append(add, strings.TrimSpace(trimmed[1:]))
+		}
+	}
+	return strings.Join(rem, "\n"), strings.Join(add, "\n")
+}
+
+func populateTestFailures(ctx context.Context, db *sql.DB, events []TestEvent) error {
+	for _, failure := range collectTestFailures(events) {
+		insertSQL := `INSERT INTO test_failures (package, test, output, message, expected, actual) VALUES (?, ?, ?, ?, ?, ?);`
+		_, err := db.ExecContext(ctx, insertSQL, failure.Package, failure.Test, failure.Output, failure.Message, failure.Expected, failure.Actual)
+		if err != nil {
+			return fmt.Errorf("failed to insert test failures: %w", err)
+		}
+	}
+	return nil
+}
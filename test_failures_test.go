@@ -0,0 +1,150 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchGotWant(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      string
+		want     string
+		got      string
+		expectOK bool
+	}{
+		{name: "got want", msg: "got 1, want 2", want: "2", got: "1", expectOK: true},
+		{name: "want got", msg: "want 2, got 1", want: "2", got: "1", expectOK: true},
+		{name: "labels with words", msg: "expected result 10, but got 1", want: "10", got: "1", expectOK: true},
+		{name: "actual expected", msg: "actual: 3 expected: 4", want: "4", got: "3", expectOK: true},
+		{name: "quoted", msg: `Name() got "hello  world", want "hello world"`, want: `"hello world"`, got: `"hello  world"`, expectOK: true},
+		{name: "composite", msg: "Sum(xs) got []int{1, 2}, want []int{1, 3}", want: "[]int{1, 3}", got: "[]int{1, 2}", expectOK: true},
+		{name: "map value", msg: "got map[a:1 b:2], want map[a:1]", want: "map[a:1]", got: "map[a:1 b:2]", expectOK: true},
+		{name: "struct value", msg: "got result &{1 2}, want &{1 3}", want: "&{1 3}", got: "&{1 2}", expectOK: true},
+		{name: "no assertion", msg: "something went wrong", expectOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, got, ok := matchGotWant(tt.msg)
+			if ok != tt.expectOK {
+				t.Fatalf("matchGotWant(%q) ok = %v, want %v", tt.msg, ok, tt.expectOK)
+			}
+			if !ok {
+				return
+			}
+			if want != tt.want || got != tt.got {
+				t.Errorf("matchGotWant(%q) = (%q, %q), want (%q, %q)", tt.msg, want, got, tt.want, tt.got)
+			}
+		})
+	}
+}
+
+func TestParseAssertion(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name     string
+		lines    []string
+		message  *string
+		expected *string
+		actual   *string
+	}{
+		{
+			name:     "single line",
+			lines:    []string{"=== RUN   TestDivide\n", "    div_test.go:16: expected result 10, but got 1\n", "--- FAIL: TestDivide (0.00s)\n"},
+			message:  ptr("expected result 10, but got 1"),
+			expected: ptr("10"),
+			actual:   ptr("1"),
+		},
+		{
+			name:     "labels on their own lines",
+			lines:    []string{"    fx_test.go:6: mismatch\n", "        got:\n", "        \t1\n", "        want:\n", "        \t2\n"},
+			message:  ptr("mismatch"),
+			expected: ptr("2"),
+			actual:   ptr("1"),
+		},
+		{
+			name:     "cmp.Diff",
+			lines:    []string{"    fx_test.go:7: Name() mismatch (-want +got):\n", "          string(\n", "        - \t\"a\",\n", "        + \t\"b\",\n", "          )\n"},
+			message:  ptr("Name() mismatch (-want +got):"),
+			expected: ptr(`"a",`),
+			actual:   ptr(`"b",`),
+		},
+		{
+			name:    "plain message",
+			lines:   []string{"    fx_test.go:8: boom\n"},
+			message: ptr("boom"),
+		},
+		{
+			name:  "no message",
+			lines: []string{"panic: runtime error\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, expected, actual := parseAssertion(tt.lines)
+			if !equalPtr(message, tt.message) || !equalPtr(expected, tt.expected) || !equalPtr(actual, tt.actual) {
+				t.Errorf("parseAssertion() = (%s, %s, %s), want (%s, %s, %s)",
+					formatPtr(message), formatPtr(expected), formatPtr(actual),
+					formatPtr(tt.message), formatPtr(tt.expected), formatPtr(tt.actual))
+			}
+		})
+	}
+}
+
+func TestParseDiffBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		removed string
+		added   string
+	}{
+		{
+			name:    "single change",
+			lines:   []string{"  string(\n", "- \t\"a\",\n", "+ \t\"b\",\n", "  )\n"},
+			removed: `"a",`,
+			added:   `"b",`,
+		},
+		{
+			name:    "several lines",
+			lines:   []string{"  []int{\n", "- \t1,\n", "- \t2,\n", "+ \t3,\n", "  }\n"},
+			removed: "1,\n2,",
+			added:   "3,",
+		},
+		{
+			name:    "stops at the next message",
+			lines:   []string{"- \ta\n", "+ \tb\n", "    fx_test.go:9: other\n", "- \tc\n"},
+			removed: "a",
+			added:   "b",
+		},
+		{
+			name:    "stops at the end of the test",
+			lines:   []string{"- \ta\n", "--- FAIL: TestX (0.00s)\n", "+ \tb\n"},
+			removed: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, added := parseDiffBlock(tt.lines)
+			if removed != tt.removed || added != tt.added {
+				t.Errorf("parseDiffBlock() = (%q, %q), want (%q, %q)", removed, added, tt.removed, tt.added)
+			}
+		})
+	}
+}
+
+func equalPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func formatPtr(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return "\"" + *s + "\""
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// assertionMethods are the testing.TB methods reporting a failure
+var assertionMethods = map[string]bool{
+	"Error": true, "Errorf": true, "Fatal": true, "Fatalf": true, "Fail": true, "FailNow": true,
+}
+
+// assertionPackages are the assertion libraries whose calls count as assertions
+var assertionPackages = map[string]bool{
+	"assert": true, "require": true,
+}
+
+// TestFunction represents a function declared in a test file
+type TestFunction struct {
+	File          string `json:"file"`
+	FunctionName  string `json:"function_name"`
+	Kind          string `json:"kind"`
+	StartLine     int    `json:"start_line"`
+	EndLine       int    `json:"end_line"`
+	IsHelper      bool   `json:"is_helper"`
+	HasAssertions bool   `json:"has_assertions"`
+
+	// calls holds the names of the functions called, to find the assertions made through helpers
+	calls map[string]bool
+}
+
+// collectTestFunctions parses the test files of the package. Functions calling t.Helper() are
+// marked as helpers, and calling a function that makes an assertion counts as making one.
+func collectTestFunctions(pkgDir string, errs *collectorErrors) ([]TestFunction, error) {
+	fileNames, err := filepath.Glob(filepath.Join(pkgDir, "*_test.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []TestFunction
+	fset := token.NewFileSet()
+	for _, fileName := range fileNames {
+		node, err := parser.ParseFile(fset, fileName, nil, parser.SkipObjectResolution)
+		if err != nil {
+			errs.add("test_functions", fileName, err)
+			continue
+		}
+
+		for _, decl := range node.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Body == nil {
+				continue
+			}
+
+			fn := TestFunction{
+				File:         filepath.Base(fileName),
+				FunctionName: funcDecl.Name.Name,
+				Kind:         testFunctionKind(funcDecl.Name.Name),
+				StartLine:    fset.Position(funcDecl.Pos()).Line,
+				EndLine:      fset.Position(funcDecl.End()).Line,
+				calls:        make(map[string]bool),
+			}
+
+			ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+
+				switch f := call.Fun.(type) {
+				case *ast.Ident:
+					fn.calls[f.Name] = true
+				case *ast.SelectorExpr:
+					switch {
+					case f.Sel.Name == "Helper" && len(call.Args) == 0:
+						fn.IsHelper = true
+					case assertionMethods[f.Sel.Name]:
+						fn.HasAssertions = true
+					default:
+						if pkg, ok := f.X.(*ast.Ident); ok && assertionPackages[pkg.Name] {
+							fn.HasAssertions = true
+						}
+					}
+				}
+				return true
+			})
+
+			results = append(results, fn)
+		}
+	}
+
+	// a function asserts when it calls a function of the test files that asserts, at any depth,
+	// so assertions made through helpers of helpers are found too
+	asserts := make(map[string]bool)
+	for _, fn := range results {
+		if fn.HasAssertions {
+			asserts[fn.FunctionName] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := range results {
+			if results[i].HasAssertions {
+				continue
+			}
+			for name := range results[i].calls {
+				if asserts[name] {
+					results[i].HasAssertions = true
+					asserts[results[i].FunctionName] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// testFunctionKind classifies a function of a test file by the naming conventions of go test
+func testFunctionKind(name string) string {
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok && (rest == "" || !isLower(rest[0])) {
+			if name == "TestMain" {
+				return "main"
+			}
+			return strings.ToLower(prefix)
+		}
+	}
+	return "function"
+}
+
+func isLower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+func populateTestFunctions(ctx context.Context, db *sql.DB, pkgDir string, errs *collectorErrors) error {
+	functions, err := collectTestFunctions(pkgDir, errs)
+	if err != nil {
+		return fmt.Errorf("failed to collect test functions: %w", err)
+	}
+
+	for _, fn := range functions {
+		insertSQL := `INSERT INTO test_functions (file, function_name, kind, start_line, end_line, is_helper, has_assertions) VALUES (?, ?, ?, ?, ?, ?, ?);`
+		_, err := db.ExecContext(ctx, insertSQL, fn.File, fn.FunctionName, fn.Kind, fn.StartLine, fn.EndLine, fn.IsHelper, fn.HasAssertions)
+		if err != nil {
+			return fmt.Errorf("failed to insert test functions: %w", err)
+		}
+	}
+	return nil
+}
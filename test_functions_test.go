@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const helpersFixture = `package fixture
+
+import "testing"
+
+func checkEqual(t *testing.T, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+}
+
+func checkPositive(t *testing.T, got int) {
+	t.Helper()
+	checkEqual(t, got, abs(got))
+}
+
+func setup(t *testing.T) int {
+	t.Helper()
+	return 1
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func TestDirect(t *testing.T) { t.Fatal("boom") }
+
+func TestHelper(t *testing.T) { checkEqual(t, 1, 1) }
+
+func TestNestedHelper(t *testing.T) { checkPositive(t, 1) }
+
+func TestSetupOnly(t *testing.T) { setup(t) }
+
+func TestNothing(t *testing.T) { abs(1) }
+`
+
+func TestCollectTestFunctions(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "fixture_test.go"), []byte(helpersFixture), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs collectorErrors
+	functions, err := collectTestFunctions(dir, &errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		kind          string
+		isHelper      bool
+		hasAssertions bool
+	}{
+		"checkEqual":       {kind: "function", isHelper: true, hasAssertions: true},
+		"checkPositive":    {kind: "function", isHelper: true, hasAssertions: true},
+		"setup":            {kind: "function", isHelper: true, hasAssertions: false},
+		"abs":              {kind: "function", isHelper: false, hasAssertions: false},
+		"TestDirect":       {kind: "test", hasAssertions: true},
+		"TestHelper":       {kind: "test", hasAssertions: true},
+		"TestNestedHelper": {kind: "test", hasAssertions: true},
+		"TestSetupOnly":    {kind: "test", hasAssertions: false},
+		"TestNothing":      {kind: "test", hasAssertions: false},
+	}
+
+	if len(functions) != len(tests) {
+		t.Fatalf("collectTestFunctions() returned %d functions, want %d", len(functions), len(tests))
+	}
+	for _, fn := range functions {
+		want, ok := tests[fn.FunctionName]
+		if !ok {
+			t.Errorf("unexpected function %s", fn.FunctionName)
+			continue
+		}
+		if fn.Kind != want.kind || fn.IsHelper != want.isHelper || fn.HasAssertions != want.hasAssertions {
+			t.Errorf("%s: got kind=%s helper=%v assertions=%v, want kind=%s helper=%v assertions=%v",
+				fn.FunctionName, fn.Kind, fn.IsHelper, fn.HasAssertions, want.kind, want.isHelper, want.hasAssertions)
+		}
+	}
+}
+
+func TestTestDurationStats(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	// the duration of TestParent includes the durations of its subtests, TestHelperProcess
+	// calls t.Helper and is not a test of its own
+	insertSQL := `INSERT INTO all_tests (time, action, package, test, elapsed, seq) VALUES (CURRENT_TIMESTAMP, 'pass', 'pkg', ?, ?, ?);`
+	for i, row := range []struct {
+		test    string
+		elapsed float64
+	}{
+		{"TestParent", 3},
+		{"TestParent/first", 1},
+		{"TestParent/second", 2},
+		{"TestOther", 1},
+		{"TestHelperProcess", 5},
+	} {
+		_, err := db.ExecContext(ctx, insertSQL, row.test, row.elapsed, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := db.ExecContext(ctx, `INSERT INTO test_functions (file, function_name, kind, start_line, end_line, is_helper, has_assertions) VALUES ('pkg_test.go', 'TestHelperProcess', 'test', 1, 3, true, false);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests int
+	var total, maxElapsed float64
+	err = db.QueryRowContext(ctx, "SELECT tests, total_elapsed, max_elapsed FROM test_duration_stats WHERE package = 'pkg';").Scan(&tests, &total, &maxElapsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests != 2 || total != 4 || maxElapsed != 3 {
+		t.Errorf("test_duration_stats = (%d, %v, %v), want (2, 4, 3)", tests, total, maxElapsed)
+	}
+}
+
+// newTestDatabase returns an in-memory database with the built-in schema
+func newTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// every connection would get its own in-memory database
+	db.SetMaxOpenConns(1)
+
+	err = createTables(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
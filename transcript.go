@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// startRecording appends every following query and its rendered result to the markdown file
+func (s *shellState) startRecording(file string) error {
+	if s.transcript != nil {
+		return fmt.Errorf("already recording to %s, use .record off first", s.transcript.Name())
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open transcript: %w", err)
+	}
+
+	_, err = fmt.Fprintf(f, "# tq session %s\n\n", time.Now().Format(time.RFC3339))
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+
+	s.transcript = f
+	return nil
+}
+
+// stopRecording closes the transcript, if any
+func (s *shellState) stopRecording() error {
+	if s.transcript == nil {
+		return nil
+	}
+
+	err := s.transcript.Close()
+	s.transcript = nil
+	if err != nil {
+		return fmt.Errorf("failed to close transcript: %w", err)
+	}
+	return nil
+}
+
+// record adds a query to the transcript with either its output or the error it failed with
+func (s *shellState) record(query, output string, queryErr error) error {
+	if s.transcript == nil {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "```sql\n%s\n```\n\n", query)
+	if queryErr != nil {
+		fmt.Fprintf(&b, "> ERROR: %s\n\n", queryErr)
+	} else if output != "" {
+		fmt.Fprintf(&b, "```\n%s```\n\n", output)
+	}
+
+	_, err := s.transcript.WriteString(b.String())
+	if err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
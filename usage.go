@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const usageDDL = `CREATE TABLE IF NOT EXISTS usage (
+		name TEXT PRIMARY KEY,
+		kind TEXT NOT NULL,
+		count INTEGER NOT NULL,
+		last_used TIMESTAMP NOT NULL
+	);`
+
+var identifierRegexp = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// createUsageTable creates the opt-in usage table if it doesn't exist yet
+func createUsageTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, usageDDL)
+	return err
+}
+
+// recordUsage increments the usage counters of every table and view referenced by query
+func recordUsage(ctx context.Context, db *sql.DB, query string) error {
+	rows, err := db.QueryContext(ctx, "SELECT name, type FROM sqlite_master WHERE type IN ('table', 'view') AND name <> 'usage';")
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	objects := make(map[string]string)
+	for rows.Next() {
+		var name, kind string
+		if err := rows.Scan(&name, &kind); err != nil {
+			return fmt.Errorf("failed to read table name: %w", err)
+		}
+		objects[strings.ToLower(name)] = kind
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	now := time.Now()
+	for _, ident := range identifierRegexp.FindAllString(query, -1) {
+		name := strings.ToLower(ident)
+		kind, ok := objects[name]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		upsertSQL := `INSERT INTO usage (name, kind, count, last_used) VALUES (?, ?, 1, ?) ON CONFLICT(name) DO UPDATE SET count = count + 1, last_used = excluded.last_used;`
+		_, err := db.ExecContext(ctx, upsertSQL, name, kind, now)
+		if err != nil {
+			return fmt.Errorf("failed to record usage: %w", err)
+		}
+	}
+
+	return nil
+}
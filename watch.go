@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+const (
+	// clearScreen moves the cursor home and clears the terminal
+	clearScreen = "\033[H\033[2J"
+
+	// highlightStart and highlightEnd surround the cells that changed since the previous refresh
+	highlightStart = "\033[1;7m"
+	highlightEnd   = "\033[0m"
+)
+
+func queryCmd(ctx context.Context, args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	addDatabaseFlags(flags, &opts)
+	addQueryFlags(flags, &opts)
+	watch := flags.Duration("watch", 0, "re-execute the query on this interval, highlighting the cells that changed")
+	recollect := flags.Bool("recollect", false, "collect the test results again before every refresh (ignored with --open)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), `Usage of query: tq query [flags] "SELECT ..."`)
+		flags.PrintDefaults()
+	}
+	query := strings.Join(parseInterspersed(flags, args), " ")
+
+	if strings.TrimSpace(query) == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *watch <= 0 {
+		db, err := loadDatabase(ctx, opts)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return runQuery(ctx, os.Stdout, db, query, opts)
+	}
+
+	return watchQuery(ctx, os.Stdout, opts, query, *watch, *recollect)
+}
+
+// watchQuery re-executes a query on an interval until the context is cancelled. Opened databases
+// are reopened on every refresh so files replaced by `tq daemon` are picked up.
+func watchQuery(ctx context.Context, w io.Writer, opts options, query string, interval time.Duration, recollect bool) error {
+	var db *sql.DB
+	defer func() {
+		if db != nil {
+			db.Close()
+		}
+	}()
+
+	var previous *queryResult
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if db == nil || opts.open || recollect {
+			if db != nil {
+				db.Close()
+			}
+
+			var err error
+			db, err = loadDatabase(ctx, opts)
+			if err != nil {
+				return err
+			}
+		}
+
+		if opts.raw {
+			// raw output is meant for pipes: no screen clearing and no highlighting, every refresh
+			// appends the rows as executeQuery prints them
+			err := executeQuery(w, db, query, opts)
+			if err != nil {
+				return err
+			}
+		} else {
+			result, err := collectQueryResult(ctx, db, query)
+			if err != nil {
+				return err
+			}
+
+			maxCellBytes := opts.maxCellBytes
+			if opts.full {
+				maxCellBytes = 0
+			}
+
+			fmt.Fprint(w, clearScreen)
+			fmt.Fprintf(w, "Every %s: %s\t%s\n\n", interval, abbreviate(query, 80), time.Now().Format(time.TimeOnly))
+			renderWatchTable(w, result, previous, maxCellBytes)
+			previous = &result
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderWatchTable prints a query result, highlighting the cells that differ from the previous
+// result at the same position. Every cell of the first result is shown plain.
+func renderWatchTable(w io.Writer, result queryResult, previous *queryResult, maxCellBytes int) {
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+
+	header := make(table.Row, len(result.columns))
+	for i, column := range result.columns {
+		header[i] = column
+	}
+	t.AppendHeader(header)
+
+	for i, values := range result.rows {
+		row := make(table.Row, len(values))
+		for j, v := range values {
+			cell := foldCell(v, maxCellBytes)
+			if previous != nil && cellChanged(*previous, i, j, v) {
+				cell = highlightStart + cell + highlightEnd
+			}
+			row[j] = cell
+		}
+		t.AppendRow(row)
+	}
+	t.Render()
+}
+
+func cellChanged(previous queryResult, row, col int, value string) bool {
+	if row >= len(previous.rows) || col >= len(previous.rows[row]) {
+		return true
+	}
+	return previous.rows[row][col] != value
+}